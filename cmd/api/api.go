@@ -1,9 +1,17 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
+	"social/social/internal/auth"
+	"social/social/internal/blob"
+	"social/social/internal/cursor"
+	"social/social/internal/images"
+	"social/social/internal/mailer"
 	"social/social/internal/store"
+	"social/social/internal/stream"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -11,14 +19,107 @@ import (
 )
 
 type application struct {
-	config config
-	store  store.Storage
+	config        config
+	store         store.Storage
+	authenticator auth.Authenticator
+	mailer        mailer.Client
+	cursors       *cursor.Signer
+	hub           *stream.Hub
+	blobs         blob.BlobStore
+	images        *images.Processor
 }
 
 type config struct {
-	addr string
-	db   dbConfig
-	env  string
+	addr        string
+	db          dbConfig
+	env         string
+	auth        authConfig
+	mail        mailConfig
+	comments    commentsConfig
+	users       usersConfig
+	pagination  paginationConfig
+	timeline    timelineConfig
+	trending    trendingConfig
+	stream      streamConfig
+	media       mediaConfig
+	images      imagesConfig
+	frontendURL string
+}
+
+type paginationConfig struct {
+	cursorSecret string
+}
+
+type commentsConfig struct {
+	maxDepth int
+}
+
+type usersConfig struct {
+	usernameCooldown time.Duration
+}
+
+type mailConfig struct {
+	fromEmail string
+	dir       string
+	exp       time.Duration
+}
+
+type authConfig struct {
+	token tokenConfig
+	roles rolesConfig
+}
+
+// rolesConfig holds the minimum role a user needs to mutate posts and
+// comments they do not own.
+type rolesConfig struct {
+	patchPost     string
+	deletePost    string
+	patchComment  string
+	deleteComment string
+}
+
+type tokenConfig struct {
+	secret string
+	aud    string
+	iss    string
+	exp    time.Duration
+}
+
+type timelineConfig struct {
+	enabled         bool
+	fanOutThreshold int
+	capacity        int
+}
+
+type trendingConfig struct {
+	refreshInterval time.Duration
+	refreshTimeout  time.Duration
+}
+
+type streamConfig struct {
+	bufferSize int
+	heartbeat  time.Duration
+}
+
+// mediaConfig selects where uploads are stored. The local backend writes
+// them to dir and serves them from the API itself.
+type mediaConfig struct {
+	backend       string
+	dir           string
+	baseURL       string
+	s3            blob.S3Config
+	maxImageSize  int64
+	maxVideoSize  int64
+	uploadTimeout time.Duration
+}
+
+type imagesConfig struct {
+	workers       int
+	queueSize     int
+	maxAttempts   int
+	retryBackoff  time.Duration
+	sweepInterval time.Duration
+	staleAfter    time.Duration
 }
 
 type dbConfig struct {
@@ -36,34 +137,144 @@ func (app *application) mount() http.Handler {
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 
-	r.Use(middleware.Timeout(60 * time.Second))
-
 	r.Route("/v1", func(r chi.Router) {
-		r.Get("/health", app.healthCheckHandler)
+		// Streams stay open for as long as the client is connected, so they are
+		// exempt from the request timeout.
+		r.With(app.authTokenMiddleware).Get("/stream", app.streamHandler)
+
+		// Uploads get their own, longer deadline.
+		r.With(app.authTokenMiddleware).Post("/media", app.uploadMediaHandler)
 
-		r.Route("/posts", func(r chi.Router) {
-			r.Post("/", app.createPostHandler)
+		if local, ok := app.blobs.(*blob.LocalStore); ok {
+			r.Handle("/media/files/*", http.StripPrefix("/v1/media/files/", noDirListing(http.FileServer(http.Dir(local.Dir())))))
+		}
 
-			r.Route("/{postID}", func(r chi.Router) {
-				r.Use(app.postsContextMiddleware)
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.Timeout(60 * time.Second))
 
-				r.Get("/", app.getPostHandler)
-				r.Delete("/", app.deletePostHandler)
-				r.Patch("/", app.patchPostHandler)
+			r.Get("/health", app.healthCheckHandler)
+
+			r.Route("/authentication", func(r chi.Router) {
+				r.Post("/user", app.registerUserHandler)
+				r.Post("/token", app.createTokenHandler)
 			})
-		})
 
-		r.Route("/users", func(r chi.Router) {
-			r.Route("/{userID}", func(r chi.Router) {
-				r.Use(app.userContenxtMiddleware)
+			r.Route("/posts", func(r chi.Router) {
+				r.Use(app.authTokenMiddleware)
+
+				r.Post("/", app.createPostHandler)
+
+				r.Route("/{postID}", func(r chi.Router) {
+					r.Use(app.postsContextMiddleware)
+
+					r.Get("/", app.getPostHandler)
+					r.Delete("/", app.checkPostOwnership(app.config.auth.roles.deletePost, app.deletePostHandler))
+					r.Patch("/", app.checkPostOwnership(app.config.auth.roles.patchPost, app.patchPostHandler))
 
-				r.Get("/", app.getUserHandler)
-				r.Put("/follow", app.followUserHandler)
-				r.Put("/unfollow", app.unfollowUserHandler)
+					r.Put("/reactions", app.reactToPostHandler)
+					r.Delete("/reactions", app.deletePostReactionHandler)
+					r.Put("/repost", app.repostHandler)
+					r.Delete("/repost", app.deleteRepostHandler)
+
+					r.Route("/comments", func(r chi.Router) {
+						r.Post("/", app.createCommentHandler)
+						r.Get("/", app.getCommentsHandler)
+
+						r.Route("/{commentID}", func(r chi.Router) {
+							r.Use(app.commentsContextMiddleware)
+
+							r.Get("/replies", app.getCommentRepliesHandler)
+							r.Patch("/", app.checkCommentOwnership(app.config.auth.roles.patchComment, app.patchCommentHandler))
+							r.Delete("/", app.checkCommentOwnership(app.config.auth.roles.deleteComment, app.deleteCommentHandler))
+						})
+					})
+				})
+			})
+
+			r.With(app.authTokenMiddleware).Get("/trending", app.getTrendingHandler)
+			r.With(app.authTokenMiddleware).Get("/search", app.searchHandler)
+
+			r.Route("/tags", func(r chi.Router) {
+				r.Use(app.authTokenMiddleware)
+
+				r.Get("/{tag}/posts", app.getTagPostsHandler)
 			})
 
-			r.Group(func(r chi.Router) {
-				r.Get("/feed", app.getUserFeedHandler)
+			r.Route("/conversations", func(r chi.Router) {
+				r.Use(app.authTokenMiddleware)
+
+				r.Post("/", app.startConversationHandler)
+				r.Get("/", app.getConversationsHandler)
+
+				r.Route("/{conversationID}", func(r chi.Router) {
+					r.Use(app.conversationsContextMiddleware)
+
+					r.Get("/", app.getConversationHandler)
+					r.Get("/messages", app.getMessagesHandler)
+					r.Post("/messages", app.sendMessageHandler)
+					r.Put("/read", app.markConversationReadHandler)
+				})
+			})
+
+			r.Route("/notifications", func(r chi.Router) {
+				r.Use(app.authTokenMiddleware)
+
+				r.Get("/", app.getNotificationsHandler)
+				r.Patch("/", app.markAllNotificationsReadHandler)
+				r.Patch("/{notificationID}", app.markNotificationReadHandler)
+			})
+
+			r.Route("/collections", func(r chi.Router) {
+				r.Use(app.authTokenMiddleware)
+
+				r.Post("/", app.createCollectionHandler)
+				r.Get("/", app.getCollectionsHandler)
+
+				r.Route("/{collectionID}", func(r chi.Router) {
+					r.Use(app.collectionsContextMiddleware)
+
+					r.Get("/", app.getCollectionPostsHandler)
+					r.Delete("/", app.deleteCollectionHandler)
+					r.Put("/posts/{postID}", app.addPostToCollectionHandler)
+					r.Delete("/posts/{postID}", app.removePostFromCollectionHandler)
+				})
+			})
+
+			r.Route("/users", func(r chi.Router) {
+				r.Put("/activate/{token}", app.activateUserHandler)
+				r.Put("/confirm-email/{token}", app.confirmEmailChangeHandler)
+
+				r.Group(func(r chi.Router) {
+					r.Use(app.authTokenMiddleware)
+
+					r.Patch("/me", app.updateProfileHandler)
+					r.Patch("/me/settings", app.updateUserSettingsHandler)
+					r.Get("/by-username/{username}", app.getUserByUsernameHandler)
+
+					r.Route("/follow-requests", func(r chi.Router) {
+						r.Get("/", app.getFollowRequestsHandler)
+						r.Put("/{requesterID}/accept", app.acceptFollowRequestHandler)
+						r.Delete("/{requesterID}", app.rejectFollowRequestHandler)
+					})
+
+					r.Route("/{userID}", func(r chi.Router) {
+						r.Use(app.userContenxtMiddleware)
+
+						r.Get("/", app.getUserHandler)
+						r.Get("/posts", app.getUserPostsHandler)
+						r.Get("/mentions", app.getUserMentionsHandler)
+						r.Get("/followers", app.getFollowersHandler)
+						r.Get("/following", app.getFollowingHandler)
+						r.Put("/follow", app.followUserHandler)
+						r.Put("/unfollow", app.unfollowUserHandler)
+						r.Put("/block", app.blockUserHandler)
+						r.Put("/unblock", app.unblockUserHandler)
+						r.Put("/mute", app.muteUserHandler)
+						r.Put("/unmute", app.unmuteUserHandler)
+					})
+
+					r.Get("/feed", app.getUserFeedHandler)
+				})
 			})
 		})
 	})
@@ -71,7 +282,9 @@ func (app *application) mount() http.Handler {
 	return r
 }
 
-func (app *application) run(mux http.Handler) error {
+// run serves mux until ctx is cancelled, then waits for the requests in
+// flight to finish.
+func (app *application) run(ctx context.Context, mux http.Handler) error {
 	srv := http.Server{
 		Addr:         app.config.addr,
 		Handler:      mux,
@@ -80,7 +293,61 @@ func (app *application) run(mux http.Handler) error {
 		IdleTimeout:  time.Minute,
 	}
 
+	// Streams never go idle, so they have to be ended for Shutdown to
+	// return.
+	srv.RegisterOnShutdown(app.hub.Close)
+
+	shutdown := make(chan error, 1)
+
+	go func() {
+		<-ctx.Done()
+
+		log.Printf("Server is shutting down")
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		shutdown <- srv.Shutdown(ctx)
+	}()
+
 	log.Printf("Server has started at %s", app.config.addr)
 
-	return srv.ListenAndServe()
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return <-shutdown
+}
+
+// validate rejects settings the application cannot run with.
+func (cfg config) validate() error {
+	if cfg.trending.refreshInterval <= 0 {
+		return errors.New("the trending refresh interval must be positive")
+	}
+
+	if cfg.trending.refreshTimeout <= 0 {
+		return errors.New("the trending refresh timeout must be positive")
+	}
+
+	if cfg.stream.heartbeat <= 0 {
+		return errors.New("the stream heartbeat must be positive")
+	}
+
+	if cfg.images.sweepInterval <= 0 {
+		return errors.New("the image sweep interval must be positive")
+	}
+
+	if cfg.images.staleAfter <= 0 {
+		return errors.New("the image processing timeout must be positive")
+	}
+
+	if cfg.pagination.cursorSecret == "" {
+		return errors.New("PAGINATION_CURSOR_SECRET must be set outside development")
+	}
+
+	if cfg.pagination.cursorSecret == cfg.auth.token.secret {
+		return errors.New("the cursor secret must differ from the auth token secret")
+	}
+
+	return nil
 }
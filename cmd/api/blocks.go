@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+func (app *application) blockUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.updateRelation(w, r, app.store.Blocks.Block)
+}
+
+func (app *application) unblockUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.updateRelation(w, r, app.store.Blocks.Unblock)
+}
+
+func (app *application) muteUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.updateRelation(w, r, app.store.Blocks.Mute)
+}
+
+func (app *application) unmuteUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.updateRelation(w, r, app.store.Blocks.Unmute)
+}
+
+type relationFunc func(ctx context.Context, userID, targetID int64) error
+
+// updateRelation applies a block or mute change from the authenticated user
+// towards the user in the URL.
+func (app *application) updateRelation(w http.ResponseWriter, r *http.Request, update relationFunc) {
+	user := getAuthUserFromContext(r)
+	target := getUserFromContext(r)
+
+	if user.ID == target.ID {
+		app.badRequestError(w, r, errors.New("you cannot block or mute yourself"))
+		return
+	}
+
+	if err := update(r.Context(), user.ID, target.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"social/social/internal/store"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type collectionKey string
+
+const collectionCtx collectionKey = "collection"
+
+type createCollectionPayload struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+func (app *application) createCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromContext(r)
+
+	var payload createCollectionPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	collection := &store.Collection{
+		UserID: user.ID,
+		Name:   payload.Name,
+	}
+
+	if err := app.store.Collections.Create(r.Context(), collection); err != nil {
+		switch {
+		case errors.Is(err, store.ErrConflict):
+			app.conflictError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, collection); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) getCollectionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromContext(r)
+
+	collections, err := app.store.Collections.GetByUserID(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, collections); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) getCollectionPostsHandler(w http.ResponseWriter, r *http.Request) {
+	collection := getCollectionFromContext(r)
+	user := getAuthUserFromContext(r)
+
+	q, err := app.parsePaginatedQuery(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	posts, err := app.store.Collections.GetPosts(r.Context(), collection.ID, user.ID, q)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	var nextCursor string
+	if len(posts) > 0 {
+		last := posts[len(posts)-1]
+
+		nextCursor, err = app.nextCursor(len(posts), q.Limit, last.SavedAt, last.ID)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if err := app.paginatedJSONResponse(w, http.StatusOK, posts, nextCursor); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) deleteCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	collection := getCollectionFromContext(r)
+
+	if err := app.store.Collections.Delete(r.Context(), collection.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) addPostToCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	collection := getCollectionFromContext(r)
+	user := getAuthUserFromContext(r)
+
+	postID, err := strconv.Atoi(chi.URLParam(r, "postID"))
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	post, err := app.store.Posts.GetById(ctx, postID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+
+		return
+	}
+
+	visible, err := app.store.Posts.IsVisibleTo(ctx, post, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if !visible {
+		app.statusNotFoundError(w, r, store.ErrNotFound)
+		return
+	}
+
+	if err := app.store.Collections.AddPost(ctx, collection.ID, post.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) removePostFromCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	collection := getCollectionFromContext(r)
+
+	postID, err := strconv.ParseInt(chi.URLParam(r, "postID"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := app.store.Collections.RemovePost(r.Context(), collection.ID, postID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// collectionsContextMiddleware loads the collection in the URL. Collections
+// are private, so other users' collections are reported as not found.
+func (app *application) collectionsContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		collectionID, err := strconv.ParseInt(chi.URLParam(r, "collectionID"), 10, 64)
+		if err != nil {
+			app.badRequestError(w, r, err)
+			return
+		}
+
+		ctx := r.Context()
+
+		collection, err := app.store.Collections.GetByID(ctx, collectionID)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.statusNotFoundError(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+
+			return
+		}
+
+		user := getAuthUserFromContext(r)
+		if collection.UserID != user.ID {
+			app.statusNotFoundError(w, r, store.ErrNotFound)
+			return
+		}
+
+		ctx = context.WithValue(ctx, collectionCtx, collection)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getCollectionFromContext(r *http.Request) *store.Collection {
+	collection, _ := r.Context().Value(collectionCtx).(*store.Collection)
+	return collection
+}
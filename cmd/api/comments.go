@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"social/social/internal/store"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type commentKey string
+
+const commentCtx commentKey = "comment"
+
+type createCommentPayload struct {
+	Content  string `json:"content" validate:"required,max=1000"`
+	ParentID *int64 `json:"parent_id" validate:"omitempty,gte=1"`
+}
+
+func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromContext(r)
+	user := getAuthUserFromContext(r)
+
+	var payload createCommentPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	if payload.ParentID != nil {
+		parent, err := app.store.Comments.GetByID(ctx, *payload.ParentID)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.badRequestError(w, r, errors.New("parent comment does not exist"))
+			default:
+				app.internalServerError(w, r, err)
+			}
+
+			return
+		}
+
+		if parent.PostID != post.ID {
+			app.badRequestError(w, r, errors.New("parent comment belongs to another post"))
+			return
+		}
+	}
+
+	comment := &store.Comment{
+		PostID:   post.ID,
+		UserID:   user.ID,
+		ParentID: payload.ParentID,
+		Content:  payload.Content,
+		User:     *user,
+	}
+
+	if err := app.store.Comments.Create(ctx, comment); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, comment); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) getCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromContext(r)
+
+	q, err := app.parseCommentsQuery(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	viewer := getAuthUserFromContext(r)
+
+	comments, err := app.store.Comments.GetByPostId(r.Context(), post.ID, viewer.ID, q)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	nextCursor, err := app.commentsNextCursor(comments, q)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.paginatedJSONResponse(w, http.StatusOK, comments, nextCursor); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) getCommentRepliesHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromContext(r)
+
+	q, err := app.parseCommentsQuery(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	viewer := getAuthUserFromContext(r)
+
+	replies, err := app.store.Comments.GetReplies(r.Context(), comment, viewer.ID, q)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	nextCursor, err := app.commentsNextCursor(replies, q)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.paginatedJSONResponse(w, http.StatusOK, replies, nextCursor); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// parseCommentsQuery reads the paging and thread depth parameters of a
+// comment listing. Depths beyond the configured maximum are clamped.
+func (app *application) parseCommentsQuery(r *http.Request) (store.PaginatedCommentsQuery, error) {
+	q := store.PaginatedCommentsQuery{
+		Limit: 20,
+	}
+
+	q, err := q.Parse(r)
+	if err != nil {
+		return q, err
+	}
+
+	q.Cursor, err = app.readCursor(r)
+	if err != nil {
+		return q, err
+	}
+
+	if err := Validate.Struct(q); err != nil {
+		return q, err
+	}
+
+	if q.Depth > app.config.comments.maxDepth {
+		q.Depth = app.config.comments.maxDepth
+	}
+
+	return q, nil
+}
+
+func (app *application) commentsNextCursor(comments []store.Comment, q store.PaginatedCommentsQuery) (string, error) {
+	if len(comments) == 0 {
+		return "", nil
+	}
+
+	last := comments[len(comments)-1]
+	return app.nextCursor(len(comments), q.Limit, last.CreatedAt, last.ID)
+}
+
+type updateCommentPayload struct {
+	Content string `json:"content" validate:"required,max=1000"`
+}
+
+func (app *application) patchCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromContext(r)
+
+	var payload updateCommentPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	comment.Content = payload.Content
+
+	if err := app.store.Comments.Update(r.Context(), comment); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, comment); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromContext(r)
+
+	if err := app.store.Comments.Delete(r.Context(), comment.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) commentsContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		commentID, err := strconv.ParseInt(chi.URLParam(r, "commentID"), 10, 64)
+		if err != nil {
+			app.badRequestError(w, r, err)
+			return
+		}
+
+		ctx := r.Context()
+
+		comment, err := app.store.Comments.GetByID(ctx, commentID)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.statusNotFoundError(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+
+			return
+		}
+
+		post := getPostFromContext(r)
+		if comment.PostID != post.ID {
+			app.statusNotFoundError(w, r, store.ErrNotFound)
+			return
+		}
+
+		ctx = context.WithValue(ctx, commentCtx, comment)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getCommentFromContext(r *http.Request) *store.Comment {
+	comment, _ := r.Context().Value(commentCtx).(*store.Comment)
+	return comment
+}
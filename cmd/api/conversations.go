@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"social/social/internal/store"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type conversationKey string
+
+const conversationCtx conversationKey = "conversation"
+
+type startConversationPayload struct {
+	MemberIDs []int64 `json:"member_ids" validate:"required,min=1,max=9,dive,gte=1"`
+}
+
+func (app *application) startConversationHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromContext(r)
+
+	var payload startConversationPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	seen := map[int64]bool{}
+	var memberIDs []int64
+
+	for _, id := range payload.MemberIDs {
+		if id == user.ID || seen[id] {
+			continue
+		}
+
+		seen[id] = true
+		memberIDs = append(memberIDs, id)
+	}
+
+	if len(memberIDs) == 0 {
+		app.badRequestError(w, r, errors.New("a conversation needs at least one other member"))
+		return
+	}
+
+	conversation, created, err := app.store.Messages.StartConversation(r.Context(), user.ID, memberIDs)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.badRequestError(w, r, errors.New("one of the members does not exist"))
+		case errors.Is(err, store.ErrBlocked):
+			app.forbiddenResponse(w, r)
+		default:
+			app.internalServerError(w, r, err)
+		}
+
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+
+	if err := app.jsonResponse(w, status, conversation); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) getConversationsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromContext(r)
+
+	q, err := app.parsePaginatedQuery(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	conversations, err := app.store.Messages.GetConversations(r.Context(), user.ID, q)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	var nextCursor string
+	if len(conversations) > 0 {
+		last := conversations[len(conversations)-1]
+
+		nextCursor, err = app.nextCursor(len(conversations), q.Limit, last.UpdatedAt, last.ID)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if err := app.paginatedJSONResponse(w, http.StatusOK, conversations, nextCursor); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) getConversationHandler(w http.ResponseWriter, r *http.Request) {
+	conversation := getConversationFromContext(r)
+
+	if err := app.jsonResponse(w, http.StatusOK, conversation); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) getMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	conversation := getConversationFromContext(r)
+	user := getAuthUserFromContext(r)
+
+	q, err := app.parsePaginatedQuery(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	messages, err := app.store.Messages.GetMessages(r.Context(), conversation.ID, user.ID, q)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	var nextCursor string
+	if len(messages) > 0 {
+		last := messages[len(messages)-1]
+
+		nextCursor, err = app.nextCursor(len(messages), q.Limit, last.CreatedAt, last.ID)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if err := app.paginatedJSONResponse(w, http.StatusOK, messages, nextCursor); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+type sendMessagePayload struct {
+	Content string `json:"content" validate:"required,max=1000"`
+}
+
+func (app *application) sendMessageHandler(w http.ResponseWriter, r *http.Request) {
+	conversation := getConversationFromContext(r)
+	user := getAuthUserFromContext(r)
+
+	var payload sendMessagePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	message := &store.Message{
+		ConversationID: conversation.ID,
+		SenderID:       user.ID,
+		Content:        payload.Content,
+		Sender:         *user,
+	}
+
+	if err := app.store.Messages.Send(r.Context(), message); err != nil {
+		switch {
+		case errors.Is(err, store.ErrBlocked):
+			app.forbiddenResponse(w, r)
+		default:
+			app.internalServerError(w, r, err)
+		}
+
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, message); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) markConversationReadHandler(w http.ResponseWriter, r *http.Request) {
+	conversation := getConversationFromContext(r)
+	user := getAuthUserFromContext(r)
+
+	if err := app.store.Messages.MarkRead(r.Context(), conversation.ID, user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// conversationsContextMiddleware loads the conversation in the URL as seen by
+// the authenticated user. Conversations they are not a member of are
+// reported as not found.
+func (app *application) conversationsContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conversationID, err := strconv.ParseInt(chi.URLParam(r, "conversationID"), 10, 64)
+		if err != nil {
+			app.badRequestError(w, r, err)
+			return
+		}
+
+		ctx := r.Context()
+		user := getAuthUserFromContext(r)
+
+		conversation, err := app.store.Messages.GetConversation(ctx, conversationID, user.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.statusNotFoundError(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+
+			return
+		}
+
+		ctx = context.WithValue(ctx, conversationCtx, conversation)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getConversationFromContext(r *http.Request) *store.Conversation {
+	conversation, _ := r.Context().Value(conversationCtx).(*store.Conversation)
+	return conversation
+}
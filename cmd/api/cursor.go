@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"social/social/internal/store"
+	"time"
+)
+
+// readCursor decodes the optional cursor query parameter.
+func (app *application) readCursor(r *http.Request) (*store.Cursor, error) {
+	token := r.URL.Query().Get("cursor")
+	if token == "" {
+		return nil, nil
+	}
+
+	c, err := app.cursors.Decode(token)
+	if err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// parsePaginatedQuery reads the limit and cursor of a plain listing.
+func (app *application) parsePaginatedQuery(r *http.Request) (store.PaginatedQuery, error) {
+	q := store.PaginatedQuery{
+		Limit: 20,
+	}
+
+	q, err := q.Parse(r)
+	if err != nil {
+		return q, err
+	}
+
+	q.Cursor, err = app.readCursor(r)
+	if err != nil {
+		return q, err
+	}
+
+	if err := Validate.Struct(q); err != nil {
+		return q, err
+	}
+
+	return q, nil
+}
+
+// nextCursor returns the cursor pointing after the last item of a full page,
+// or an empty string when there are no more pages.
+func (app *application) nextCursor(pageLen, limit int, createdAt string, id int64) (string, error) {
+	if pageLen < limit {
+		return "", nil
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return "", err
+	}
+
+	return app.cursors.Encode(store.Cursor{CreatedAt: t, ID: id})
+}
@@ -28,3 +28,27 @@ func (app *application) conflictError(w http.ResponseWriter, r *http.Request, er
 
 	writeJSONError(w, http.StatusConflict, err.Error())
 }
+
+func (app *application) unauthorizedError(w http.ResponseWriter, r *http.Request, err error) {
+	log.Printf("Unauthorized: %s path: %s error: %s", r.Method, r.URL.Path, err)
+
+	writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+}
+
+func (app *application) forbiddenResponse(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Forbidden: %s path: %s", r.Method, r.URL.Path)
+
+	writeJSONError(w, http.StatusForbidden, "forbidden")
+}
+
+func (app *application) payloadTooLargeError(w http.ResponseWriter, r *http.Request, err error) {
+	log.Printf("Payload too large: %s path: %s error: %s", r.Method, r.URL.Path, err)
+
+	writeJSONError(w, http.StatusRequestEntityTooLarge, err.Error())
+}
+
+func (app *application) unsupportedMediaTypeError(w http.ResponseWriter, r *http.Request, err error) {
+	log.Printf("Unsupported media type: %s path: %s error: %s", r.Method, r.URL.Path, err)
+
+	writeJSONError(w, http.StatusUnsupportedMediaType, err.Error())
+}
@@ -2,18 +2,63 @@ package main
 
 import (
 	"net/http"
+	"social/social/internal/store"
 )
 
 func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Request) {
+	fq := store.PaginatedFeedQuery{
+		Limit: 20,
+		Sort:  "desc",
+	}
+
+	fq, err := fq.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	fq.Cursor, err = app.readCursor(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(fq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getAuthUserFromContext(r)
 	ctx := r.Context()
 
-	feed, err := app.store.Posts.GetUserFeed(ctx, int64(3))
+	feed, err := app.store.Posts.GetUserFeed(ctx, user.ID, fq)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
-	if err := app.jsonResponse(w, http.StatusOK, feed); err != nil {
+	posts := make([]*store.Post, len(feed))
+	for i := range feed {
+		posts[i] = &feed[i].Post
+	}
+
+	if err := app.loadPostsMedia(ctx, posts); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	var nextCursor string
+	if len(feed) > 0 {
+		last := feed[len(feed)-1]
+
+		nextCursor, err = app.nextCursor(len(feed), fq.Limit, last.FeedAt, last.ID)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if err := app.paginatedJSONResponse(w, http.StatusOK, feed, nextCursor); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"social/social/internal/store"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func (app *application) getFollowRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromContext(r)
+
+	q, err := app.parsePaginatedQuery(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	requests, err := app.store.Followers.GetFollowRequests(r.Context(), user.ID, q)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	var nextCursor string
+	if len(requests) > 0 {
+		last := requests[len(requests)-1]
+
+		nextCursor, err = app.nextCursor(len(requests), q.Limit, last.RequestedAt, last.User.ID)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if err := app.paginatedJSONResponse(w, http.StatusOK, requests, nextCursor); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) acceptFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromContext(r)
+
+	requesterID, err := strconv.ParseInt(chi.URLParam(r, "requesterID"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := app.store.Followers.AcceptRequest(r.Context(), user.ID, requesterID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFoundError(w, r, err)
+		case errors.Is(err, store.ErrConflict):
+			app.conflictError(w, r, err)
+		case errors.Is(err, store.ErrBlocked):
+			app.forbiddenResponse(w, r)
+		default:
+			app.internalServerError(w, r, err)
+		}
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) rejectFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromContext(r)
+
+	requesterID, err := strconv.ParseInt(chi.URLParam(r, "requesterID"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := app.store.Followers.RejectRequest(r.Context(), user.ID, requesterID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"encoding/json"
 	"net/http"
+	"social/social/internal/extract"
 
 	"github.com/go-playground/validator/v10"
 )
@@ -11,6 +12,12 @@ var Validate *validator.Validate
 
 func init() {
 	Validate = validator.New(validator.WithRequiredStructEnabled())
+
+	// Usernames must be mentionable, both at registration and when they are
+	// changed later.
+	Validate.RegisterValidation("username", func(fl validator.FieldLevel) bool {
+		return extract.IsMentionable(fl.Field().String())
+	})
 }
 
 func writeJSON(w http.ResponseWriter, status int, data any) error {
@@ -44,3 +51,12 @@ func (app *application) jsonResponse(w http.ResponseWriter, status int, data any
 
 	return writeJSON(w, status, &envelope{Data: data})
 }
+
+func (app *application) paginatedJSONResponse(w http.ResponseWriter, status int, data any, nextCursor string) error {
+	type envelope struct {
+		Data       any    `json:"data"`
+		NextCursor string `json:"next_cursor,omitempty"`
+	}
+
+	return writeJSON(w, status, &envelope{Data: data, NextCursor: nextCursor})
+}
@@ -1,10 +1,22 @@
 package main
 
 import (
+	"context"
 	"log"
+	"os"
+	"os/signal"
+	"social/social/internal/auth"
+	"social/social/internal/blob"
+	"social/social/internal/cursor"
 	"social/social/internal/db"
 	"social/social/internal/env"
+	"social/social/internal/images"
+	"social/social/internal/mailer"
 	"social/social/internal/store"
+	"social/social/internal/stream"
+	"sync"
+	"syscall"
+	"time"
 )
 
 const version = "0.0.1"
@@ -18,7 +30,88 @@ func main() {
 			maxIdleConns: env.GetInt("DB_MAX_IDLE_CONNS", 30),
 			maxIdleTime:  env.GetString("DB_MAX_IDLE_TIME", "15m"),
 		},
-		env: env.GetString("ENV", "development"),
+		env:         env.GetString("ENV", "development"),
+		frontendURL: env.GetString("FRONTEND_URL", "http://localhost:5173"),
+		timeline: timelineConfig{
+			enabled:         env.GetBool("TIMELINE_ENABLED", false),
+			fanOutThreshold: env.GetInt("TIMELINE_FANOUT_THRESHOLD", 10_000),
+			capacity:        env.GetInt("TIMELINE_CAPACITY", 800),
+		},
+		trending: trendingConfig{
+			refreshInterval: env.GetDuration("TRENDING_REFRESH_INTERVAL", time.Minute*5),
+			refreshTimeout:  env.GetDuration("TRENDING_REFRESH_TIMEOUT", time.Minute*2),
+		},
+		stream: streamConfig{
+			bufferSize: env.GetInt("STREAM_BUFFER_SIZE", 64),
+			heartbeat:  env.GetDuration("STREAM_HEARTBEAT", time.Second*15),
+		},
+		media: mediaConfig{
+			backend: env.GetString("MEDIA_BACKEND", "local"),
+			dir:     env.GetString("MEDIA_DIR", "tmp/media"),
+			baseURL: env.GetString("MEDIA_BASE_URL", "http://localhost:8080/v1/media/files"),
+			s3: blob.S3Config{
+				Endpoint:  env.GetString("MEDIA_S3_ENDPOINT", "http://localhost:9000"),
+				Region:    env.GetString("MEDIA_S3_REGION", "us-east-1"),
+				Bucket:    env.GetString("MEDIA_S3_BUCKET", "media"),
+				AccessKey: env.GetString("MEDIA_S3_ACCESS_KEY", ""),
+				SecretKey: env.GetString("MEDIA_S3_SECRET_KEY", ""),
+				PublicURL: env.GetString("MEDIA_S3_PUBLIC_URL", ""),
+			},
+			maxImageSize:  int64(env.GetInt("MEDIA_MAX_IMAGE_SIZE", 10<<20)),
+			maxVideoSize:  int64(env.GetInt("MEDIA_MAX_VIDEO_SIZE", 100<<20)),
+			uploadTimeout: env.GetDuration("MEDIA_UPLOAD_TIMEOUT", time.Minute*5),
+		},
+		images: imagesConfig{
+			workers:       env.GetInt("IMAGES_WORKERS", 4),
+			queueSize:     env.GetInt("IMAGES_QUEUE_SIZE", 256),
+			maxAttempts:   env.GetInt("IMAGES_MAX_ATTEMPTS", 5),
+			retryBackoff:  env.GetDuration("IMAGES_RETRY_BACKOFF", time.Second*30),
+			sweepInterval: env.GetDuration("IMAGES_SWEEP_INTERVAL", time.Minute),
+			staleAfter:    env.GetDuration("IMAGES_STALE_AFTER", time.Minute*5),
+		},
+		pagination: paginationConfig{
+			cursorSecret: env.GetString("PAGINATION_CURSOR_SECRET", ""),
+		},
+		comments: commentsConfig{
+			maxDepth: env.GetInt("COMMENTS_MAX_DEPTH", 5),
+		},
+		users: usersConfig{
+			usernameCooldown: env.GetDuration("USERS_USERNAME_COOLDOWN", time.Hour*24*30),
+		},
+		mail: mailConfig{
+			fromEmail: env.GetString("MAIL_FROM_EMAIL", "noreply@gosocial.local"),
+			dir:       env.GetString("MAIL_DIR", "tmp/mail"),
+			exp:       env.GetDuration("MAIL_INVITATION_EXP", time.Hour*24*3),
+		},
+		auth: authConfig{
+			token: tokenConfig{
+				secret: env.GetString("AUTH_TOKEN_SECRET", "example"),
+				aud:    env.GetString("AUTH_TOKEN_AUD", "gosocial"),
+				iss:    env.GetString("AUTH_TOKEN_ISS", "gosocial"),
+				exp:    env.GetDuration("AUTH_TOKEN_EXP", time.Hour*24*3),
+			},
+			roles: rolesConfig{
+				patchPost:     env.GetString("AUTH_ROLE_PATCH_POST", "moderator"),
+				deletePost:    env.GetString("AUTH_ROLE_DELETE_POST", "admin"),
+				patchComment:  env.GetString("AUTH_ROLE_PATCH_COMMENT", "moderator"),
+				deleteComment: env.GetString("AUTH_ROLE_DELETE_COMMENT", "admin"),
+			},
+		},
+	}
+
+	// Cursors only have to outlive the process in development, so a random
+	// secret spares setting one up.
+	if cfg.pagination.cursorSecret == "" && cfg.env == "development" {
+		secret, err := generateToken()
+		if err != nil {
+			log.Panic(err)
+		}
+
+		cfg.pagination.cursorSecret = secret
+	}
+
+	if err := cfg.validate(); err != nil {
+		log.Panic(err)
 	}
 
 	db, err := db.New(
@@ -35,14 +128,88 @@ func main() {
 	defer db.Close()
 	log.Println("Database connection pool established")
 
-	store := store.NewStorage(db)
+	store := store.NewStorage(db, store.TimelineConfig{
+		Enabled:         cfg.timeline.enabled,
+		FanOutThreshold: cfg.timeline.fanOutThreshold,
+		Capacity:        cfg.timeline.capacity,
+	})
+
+	jwtAuthenticator := auth.NewJWTAuthenticator(
+		cfg.auth.token.secret,
+		cfg.auth.token.aud,
+		cfg.auth.token.iss,
+	)
+
+	mailClient, err := mailer.NewFileMailer(cfg.mail.fromEmail, cfg.mail.dir)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	var blobs blob.BlobStore
+	switch cfg.media.backend {
+	case "s3":
+		blobs, err = blob.NewS3Store(cfg.media.s3)
+	default:
+		blobs, err = blob.NewLocalStore(cfg.media.dir, cfg.media.baseURL)
+	}
+
+	if err != nil {
+		log.Panic(err)
+	}
 
 	app := &application{
-		config: cfg,
-		store:  store,
+		config:        cfg,
+		store:         store,
+		authenticator: jwtAuthenticator,
+		mailer:        mailClient,
+		cursors:       cursor.NewSigner(cfg.pagination.cursorSecret),
+		hub:           stream.NewHub(cfg.stream.bufferSize),
+		blobs:         blobs,
+		images: images.NewProcessor(store, blobs, images.Config{
+			Workers:       cfg.images.workers,
+			QueueSize:     cfg.images.queueSize,
+			MaxAttempts:   cfg.images.maxAttempts,
+			RetryBackoff:  cfg.images.retryBackoff,
+			SweepInterval: cfg.images.sweepInterval,
+			StaleAfter:    cfg.images.staleAfter,
+		}),
 	}
 
+	// Background work stops along with the server.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		if err := stream.Listen(ctx, cfg.db.addr, app.hub, app.loadStreamEvent); err != nil {
+			log.Printf("error listening for stream events: %s", err)
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		app.runTrendingAggregator(ctx)
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		app.images.Run(ctx)
+	}()
+
 	mux := app.mount()
 
-	log.Fatal(app.run(mux))
+	err = app.run(ctx, mux)
+
+	stop()
+	wg.Wait()
+
+	if err != nil {
+		log.Fatal(err)
+	}
 }
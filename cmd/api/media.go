@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"social/social/internal/store"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// mediaTypes lists the accepted content types along with the kind of media
+// and the file extension they are stored with.
+var mediaTypes = map[string]struct {
+	kind string
+	ext  string
+}{
+	"image/jpeg": {"image", ".jpg"},
+	"image/png":  {"image", ".png"},
+	"image/gif":  {"image", ".gif"},
+	"image/webp": {"image", ".webp"},
+	"video/mp4":  {"video", ".mp4"},
+	"video/webm": {"video", ".webm"},
+}
+
+// uploadMediaHandler stores the file sent in the "file" field of a multipart
+// form. The content type is sniffed from the file itself rather than trusted
+// from the client. The returned media can be attached to a post by its id.
+func (app *application) uploadMediaHandler(w http.ResponseWriter, r *http.Request) {
+	// The server timeouts are too short for large files to make it through.
+	rc := http.NewResponseController(w)
+	deadline := time.Now().Add(app.config.media.uploadTimeout)
+
+	if err := rc.SetReadDeadline(deadline); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := rc.SetWriteDeadline(deadline); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	maxSize := max(app.config.media.maxImageSize, app.config.media.maxVideoSize)
+
+	// Leave some room for the multipart framing around the file.
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+1<<20)
+
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesErr):
+			app.payloadTooLargeError(w, r, fmt.Errorf("file must not exceed %d bytes", maxSize))
+		default:
+			app.badRequestError(w, r, err)
+		}
+
+		return
+	}
+
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	defer file.Close()
+
+	sniff := make([]byte, 512)
+	n, err := io.ReadFull(file, sniff)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	contentType := http.DetectContentType(sniff[:n])
+
+	mediaType, ok := mediaTypes[contentType]
+	if !ok {
+		app.unsupportedMediaTypeError(w, r, fmt.Errorf("unsupported media type %s", contentType))
+		return
+	}
+
+	limit := app.config.media.maxImageSize
+	if mediaType.kind == "video" {
+		limit = app.config.media.maxVideoSize
+	}
+
+	if header.Size > limit {
+		app.payloadTooLargeError(w, r, fmt.Errorf("%s must not exceed %d bytes", mediaType.kind, limit))
+		return
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	user := getAuthUserFromContext(r)
+	ctx := r.Context()
+
+	name := make([]byte, 16)
+	if _, err := rand.Read(name); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	key := strconv.FormatInt(user.ID, 10) + "/" + hex.EncodeToString(name) + mediaType.ext
+
+	if err := app.blobs.Put(ctx, key, file, header.Size, contentType); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	media := &store.Media{
+		UserID:      user.ID,
+		Kind:        mediaType.kind,
+		ContentType: contentType,
+		Size:        header.Size,
+		StorageKey:  key,
+		Status:      store.MediaReady,
+	}
+
+	// The URL of an image is withheld until the copy stripped of its
+	// metadata is stored, so that the upload itself is never handed out.
+	if mediaType.kind == "image" {
+		media.Status = store.MediaPending
+	} else {
+		url := app.blobs.URL(key)
+		media.URL = &url
+	}
+
+	if err := app.store.Media.Create(ctx, media); err != nil {
+		// Do not leave behind a blob nothing refers to.
+		_ = app.blobs.Delete(ctx, key)
+
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if media.Status == store.MediaPending {
+		app.images.Enqueue(media.ID)
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, media); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// loadPostsMedia fills in the attachments of the posts.
+func (app *application) loadPostsMedia(ctx context.Context, posts []*store.Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(posts))
+	for i, post := range posts {
+		ids[i] = post.ID
+	}
+
+	media, err := app.store.Media.GetByPostIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, post := range posts {
+		post.Media = media[post.ID]
+
+		if post.Media == nil {
+			post.Media = []store.Media{}
+		}
+	}
+
+	return nil
+}
+
+// noDirListing stops the file server from listing the uploads of a user.
+func noDirListing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/") {
+			http.NotFound(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
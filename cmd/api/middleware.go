@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"social/social/internal/store"
+	"strconv"
+	"strings"
+)
+
+const authUserCtx userKey = "authUser"
+
+func (app *application) authTokenMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			app.unauthorizedError(w, r, errors.New("authorization header is missing"))
+			return
+		}
+
+		parts := strings.Split(authHeader, " ")
+		if len(parts) != 2 || parts[0] != "Bearer" {
+			app.unauthorizedError(w, r, errors.New("authorization header is malformed"))
+			return
+		}
+
+		token, err := app.authenticator.ValidateToken(parts[1])
+		if err != nil {
+			app.unauthorizedError(w, r, err)
+			return
+		}
+
+		sub, err := token.Claims.GetSubject()
+		if err != nil {
+			app.unauthorizedError(w, r, err)
+			return
+		}
+
+		userID, err := strconv.Atoi(sub)
+		if err != nil {
+			app.unauthorizedError(w, r, fmt.Errorf("invalid subject claim: %w", err))
+			return
+		}
+
+		ctx := r.Context()
+
+		user, err := app.store.Users.GetUserById(ctx, userID)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.unauthorizedError(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+
+			return
+		}
+
+		ctx = context.WithValue(ctx, authUserCtx, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getAuthUserFromContext(r *http.Request) *store.User {
+	user, _ := r.Context().Value(authUserCtx).(*store.User)
+	return user
+}
+
+// checkPostOwnership only lets the post's author, or a user whose role is at
+// least as privileged as requiredRole, through to next.
+func (app *application) checkPostOwnership(requiredRole string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := getAuthUserFromContext(r)
+		post := getPostFromContext(r)
+
+		if post.UserID == user.ID {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		allowed, err := app.checkRolePrecedence(r.Context(), user, requiredRole)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if !allowed {
+			app.forbiddenResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// checkCommentOwnership is the comment counterpart of checkPostOwnership.
+func (app *application) checkCommentOwnership(requiredRole string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := getAuthUserFromContext(r)
+		comment := getCommentFromContext(r)
+
+		if comment.UserID == user.ID {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		allowed, err := app.checkRolePrecedence(r.Context(), user, requiredRole)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if !allowed {
+			app.forbiddenResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+func (app *application) checkRolePrecedence(ctx context.Context, user *store.User, roleName string) (bool, error) {
+	role, err := app.store.Roles.GetByName(ctx, roleName)
+	if err != nil {
+		return false, err
+	}
+
+	return user.Role.Level >= role.Level, nil
+}
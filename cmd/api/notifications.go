@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"social/social/internal/store"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type notificationsResponse struct {
+	UnreadCount   int                  `json:"unread_count"`
+	Notifications []store.Notification `json:"notifications"`
+}
+
+func (app *application) getNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromContext(r)
+
+	q, err := app.parsePaginatedQuery(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	notifications, err := app.store.Notifications.GetByUserID(ctx, user.ID, q)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	unread, err := app.store.Notifications.CountUnread(ctx, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	var nextCursor string
+	if len(notifications) > 0 {
+		last := notifications[len(notifications)-1]
+
+		nextCursor, err = app.nextCursor(len(notifications), q.Limit, last.CreatedAt, last.ID)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	res := notificationsResponse{
+		UnreadCount:   unread,
+		Notifications: notifications,
+	}
+
+	if err := app.paginatedJSONResponse(w, http.StatusOK, res, nextCursor); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) markNotificationReadHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromContext(r)
+
+	notificationID, err := strconv.ParseInt(chi.URLParam(r, "notificationID"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := app.store.Notifications.MarkRead(r.Context(), user.ID, notificationID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) markAllNotificationsReadHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromContext(r)
+
+	if err := app.store.Notifications.MarkAllRead(r.Context(), user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"social/social/internal/extract"
 	"social/social/internal/store"
 	"strconv"
 
@@ -15,9 +16,11 @@ type postKey string
 const postCtx postKey = "post"
 
 type createPostPayload struct {
-	Title   string   `json:"title" validate:"required,max=100"`
-	Content string   `json:"content" validate:"required,max=1000"`
-	Tags    []string `json:"tags" validate:""`
+	Title        string   `json:"title" validate:"required,max=100"`
+	Content      string   `json:"content" validate:"required,max=1000"`
+	Tags         []string `json:"tags" validate:"max=10,dive,max=100"`
+	QuotedPostID *int64   `json:"quoted_post_id" validate:"omitempty,gte=1"`
+	MediaIDs     []int64  `json:"media_ids" validate:"max=4,unique,dive,gte=1"`
 }
 
 func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request) {
@@ -32,20 +35,63 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	user := getAuthUserFromContext(r)
+	ctx := r.Context()
+
+	if payload.QuotedPostID != nil {
+		quoted, err := app.store.Posts.GetById(ctx, int(*payload.QuotedPostID))
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.badRequestError(w, r, errors.New("quoted post does not exist"))
+			default:
+				app.internalServerError(w, r, err)
+			}
+
+			return
+		}
+
+		visible, err := app.store.Posts.IsVisibleTo(ctx, quoted, user.ID)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if !visible {
+			app.badRequestError(w, r, errors.New("quoted post does not exist"))
+			return
+		}
+	}
+
 	post := &store.Post{
-		Title:   payload.Title,
-		Content: payload.Content,
-		Tags:    payload.Tags,
-		UserID:  1,
+		Title:        payload.Title,
+		Content:      payload.Content,
+		Tags:         payload.Tags,
+		UserID:       user.ID,
+		QuotedPostID: payload.QuotedPostID,
+		Media:        make([]store.Media, len(payload.MediaIDs)),
 	}
 
-	ctx := r.Context()
+	for i, id := range payload.MediaIDs {
+		post.Media[i].ID = id
+	}
 
-	if err := app.store.Posts.Create(ctx, post); err != nil {
+	if err := app.extractPostEntities(ctx, post); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
+	if err := app.store.Posts.Create(ctx, post); err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidAttachment):
+			app.badRequestError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+
+		return
+	}
+
 	if err := app.jsonResponse(w, http.StatusCreated, post); err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -55,7 +101,13 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 	post := getPostFromContext(r)
 
-	comments, err := app.store.Comments.GetByPostId(r.Context(), post.ID)
+	q := store.PaginatedCommentsQuery{
+		Limit: 20,
+	}
+
+	viewer := getAuthUserFromContext(r)
+
+	comments, err := app.store.Comments.GetByPostId(r.Context(), post.ID, viewer.ID, q)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -63,21 +115,29 @@ func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 
 	post.Comments = comments
 
-	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
+	post.Reactions, post.ViewerReaction, err = app.store.Reactions.GetSummary(r.Context(), post.ID, viewer.ID)
+	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
-}
 
-func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request) {
-	postId, err := strconv.Atoi(chi.URLParam(r, "postID"))
+	post.Media, err = app.store.Media.GetByPostID(r.Context(), post.ID)
 	if err != nil {
-		app.badRequestError(w, r, err)
+		app.internalServerError(w, r, err)
 		return
 	}
+
+	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromContext(r)
 	ctx := r.Context()
 
-	err = app.store.Posts.Delete(ctx, postId)
+	err := app.store.Posts.Delete(ctx, int(post.ID))
 
 	if err != nil {
 		switch {
@@ -86,6 +146,8 @@ func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request
 		default:
 			app.internalServerError(w, r, err)
 		}
+
+		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
@@ -117,7 +179,14 @@ func (app *application) patchPostHandler(w http.ResponseWriter, r *http.Request)
 		post.Title = *payload.Title
 	}
 
-	if err := app.store.Posts.Patch(r.Context(), post); err != nil {
+	ctx := r.Context()
+
+	if err := app.extractPostEntities(ctx, post); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.Posts.Patch(ctx, post); err != nil {
 		switch {
 		case errors.Is(err, store.ErrNotFound):
 			app.conflictError(w, r, err)
@@ -134,6 +203,41 @@ func (app *application) patchPostHandler(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// extractPostEntities sets the hashtags and mentions found in the post's
+// content. Mentions of usernames that do not belong to an active user are
+// dropped.
+func (app *application) extractPostEntities(ctx context.Context, post *store.Post) error {
+	post.Hashtags = extract.Hashtags(post.Content)
+	post.Mentions = []store.Mention{}
+
+	usernames := extract.Mentions(post.Content)
+	if len(usernames) == 0 {
+		return nil
+	}
+
+	users, err := app.store.Users.GetByUsernames(ctx, usernames)
+	if err != nil {
+		return err
+	}
+
+	for _, u := range users {
+		post.Mentions = append(post.Mentions, store.Mention{UserID: u.ID, Username: u.Username})
+	}
+
+	return nil
+}
+
+// postsNextCursor returns the cursor following a page of posts listed newest
+// first.
+func (app *application) postsNextCursor(posts []store.PostWithMetaData, q store.PaginatedQuery) (string, error) {
+	if len(posts) == 0 {
+		return "", nil
+	}
+
+	last := posts[len(posts)-1]
+	return app.nextCursor(len(posts), q.Limit, last.CreatedAt, last.ID)
+}
+
 func (app *application) postsContextMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		postId, err := strconv.Atoi(chi.URLParam(r, "postID"))
@@ -155,6 +259,19 @@ func (app *application) postsContextMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		viewer := getAuthUserFromContext(r)
+
+		visible, err := app.store.Posts.IsVisibleTo(ctx, post, viewer.ID)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if !visible {
+			app.statusNotFoundError(w, r, store.ErrNotFound)
+			return
+		}
+
 		ctx = context.WithValue(ctx, postCtx, post)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"social/social/internal/store"
+)
+
+type reactToPostPayload struct {
+	Type string `json:"type" validate:"required,oneof=like love laugh wow sad angry"`
+}
+
+func (app *application) reactToPostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromContext(r)
+	user := getAuthUserFromContext(r)
+
+	var payload reactToPostPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	reaction := &store.Reaction{
+		PostID: post.ID,
+		UserID: user.ID,
+		Type:   payload.Type,
+	}
+
+	if err := app.store.Reactions.Upsert(r.Context(), reaction); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, reaction); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) deletePostReactionHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromContext(r)
+	user := getAuthUserFromContext(r)
+
+	if err := app.store.Reactions.Delete(r.Context(), post.ID, user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"social/social/internal/store"
+)
+
+func (app *application) repostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromContext(r)
+	user := getAuthUserFromContext(r)
+
+	repost := &store.Repost{
+		UserID: user.ID,
+		PostID: post.ID,
+	}
+
+	if err := app.store.Reposts.Create(r.Context(), repost); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, repost); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) deleteRepostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromContext(r)
+	user := getAuthUserFromContext(r)
+
+	if err := app.store.Reposts.Delete(r.Context(), user.ID, post.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
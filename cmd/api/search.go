@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"social/social/internal/store"
+)
+
+func (app *application) searchHandler(w http.ResponseWriter, r *http.Request) {
+	q := store.SearchQuery{
+		Type:  "posts",
+		Limit: 20,
+	}
+
+	q, err := q.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(q); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	viewer := getAuthUserFromContext(r)
+
+	var results any
+
+	switch q.Type {
+	case "users":
+		results, err = app.store.Search.SearchUsers(ctx, viewer.ID, q)
+	default:
+		results, err = app.store.Search.SearchPosts(ctx, viewer.ID, q)
+	}
+
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, results); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"social/social/internal/store"
+	"social/social/internal/stream"
+	"time"
+)
+
+// streamHandler pushes new posts from the accounts in the user's feed,
+// comments on their posts and their notifications as Server-Sent Events.
+// Follows and mutes made while connected apply from the next connection.
+func (app *application) streamHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromContext(r)
+	ctx := r.Context()
+
+	authorIDs, err := app.store.Followers.GetFeedAuthorIDs(ctx, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+
+	// The server write timeout would otherwise end the stream.
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	topics := []string{stream.UserTopic(user.ID)}
+	for _, id := range authorIDs {
+		topics = append(topics, stream.AuthorTopic(id))
+	}
+
+	sub := app.hub.Subscribe(topics...)
+	defer app.hub.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	if err := rc.Flush(); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	heartbeat := time.NewTicker(app.config.stream.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-sub.C:
+			// The hub is closed when the server shuts down.
+			if !ok {
+				return
+			}
+
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, e.Data)
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(w, ": heartbeat\n\n")
+		}
+
+		if err == nil {
+			err = rc.Flush()
+		}
+
+		// Write errors mean the client went away.
+		if err != nil {
+			return
+		}
+	}
+}
+
+// loadStreamEvent loads the post, comment, notification or message a stream
+// event is about, for stream.Listen.
+func (app *application) loadStreamEvent(ctx context.Context, eventType string, id int64) (any, error) {
+	var row any
+	var err error
+
+	switch eventType {
+	case "post":
+		row, err = app.store.Posts.GetById(ctx, int(id))
+	case "comment":
+		row, err = app.store.Comments.GetByID(ctx, id)
+	case "notification":
+		row, err = app.store.Notifications.GetByID(ctx, id)
+	case "message":
+		row, err = app.store.Messages.GetByID(ctx, id)
+	default:
+		return nil, fmt.Errorf("unknown stream event type %q", eventType)
+	}
+
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+
+	return row, nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"social/social/internal/extract"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func (app *application) getTagPostsHandler(w http.ResponseWriter, r *http.Request) {
+	tag := extract.NormalizeTag(chi.URLParam(r, "tag"))
+	if tag == "" || len([]rune(tag)) > extract.MaxLength {
+		app.badRequestError(w, r, errors.New("invalid tag"))
+		return
+	}
+
+	q, err := app.parsePaginatedQuery(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	viewer := getAuthUserFromContext(r)
+
+	posts, err := app.store.Posts.GetByTag(r.Context(), tag, viewer.ID, q)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	nextCursor, err := app.postsNextCursor(posts, q)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.paginatedJSONResponse(w, http.StatusOK, posts, nextCursor); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"social/social/internal/store"
+	"time"
+)
+
+type trendingResponse struct {
+	Window string               `json:"window"`
+	Tags   []store.TrendingTag  `json:"tags"`
+	Posts  []store.TrendingPost `json:"posts"`
+}
+
+func (app *application) getTrendingHandler(w http.ResponseWriter, r *http.Request) {
+	q := store.TrendingQuery{
+		Window: "24h",
+		Limit:  10,
+	}
+
+	q, err := q.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(q); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	viewer := getAuthUserFromContext(r)
+
+	tags, err := app.store.Trending.GetTags(ctx, q)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	posts, err := app.store.Trending.GetPosts(ctx, viewer.ID, q)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	res := trendingResponse{
+		Window: q.Window,
+		Tags:   tags,
+		Posts:  posts,
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, res); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// runTrendingAggregator refreshes the trending summary right away and then on
+// every tick of the configured interval until ctx is cancelled.
+func (app *application) runTrendingAggregator(ctx context.Context) {
+	ticker := time.NewTicker(app.config.trending.refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		refreshCtx, cancel := context.WithTimeout(ctx, app.config.trending.refreshTimeout)
+
+		if err := app.store.Trending.Refresh(refreshCtx); err != nil {
+			log.Printf("error refreshing trending summary: %s", err)
+		}
+
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
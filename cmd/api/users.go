@@ -3,9 +3,13 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"social/social/internal/mailer"
 	"social/social/internal/store"
 	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 )
@@ -14,34 +18,161 @@ type userKey string
 
 const userCtx userKey = "user"
 
-type FollowUser struct {
-	UserID int64 `json:"user_id"`
+func (app *application) getUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	viewer := getAuthUserFromContext(r)
+
+	profile, err := app.store.Users.GetProfile(r.Context(), user, viewer.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, profile); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
 }
 
-func (app *application) getUserHandler(w http.ResponseWriter, r *http.Request) {
+func (app *application) getUserPostsHandler(w http.ResponseWriter, r *http.Request) {
 	user := getUserFromContext(r)
 
-	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
+	q, err := app.parsePaginatedQuery(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	viewer := getAuthUserFromContext(r)
+
+	posts, err := app.store.Posts.GetByUserID(r.Context(), user.ID, viewer.ID, q)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	nextCursor, err := app.postsNextCursor(posts, q)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.paginatedJSONResponse(w, http.StatusOK, posts, nextCursor); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 }
 
-func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request) {
-	followerUser := getUserFromContext(r)
+func (app *application) getUserMentionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
 
-	var payload FollowUser
-	if err := readJSON(w, r, &payload); err != nil {
+	q, err := app.parsePaginatedQuery(r)
+	if err != nil {
 		app.badRequestError(w, r, err)
 		return
 	}
 
+	viewer := getAuthUserFromContext(r)
+
+	posts, err := app.store.Posts.GetMentioning(r.Context(), user.ID, viewer.ID, q)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	nextCursor, err := app.postsNextCursor(posts, q)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.paginatedJSONResponse(w, http.StatusOK, posts, nextCursor); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) getFollowersHandler(w http.ResponseWriter, r *http.Request) {
+	app.listFollows(w, r, app.store.Followers.GetFollowers)
+}
+
+func (app *application) getFollowingHandler(w http.ResponseWriter, r *http.Request) {
+	app.listFollows(w, r, app.store.Followers.GetFollowing)
+}
+
+type followListFunc func(ctx context.Context, userID, viewerID int64, q store.PaginatedQuery) ([]store.FollowEntry, error)
+
+func (app *application) listFollows(w http.ResponseWriter, r *http.Request, list followListFunc) {
+	user := getUserFromContext(r)
+	viewer := getAuthUserFromContext(r)
+
+	q, err := app.parsePaginatedQuery(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	entries, err := list(r.Context(), user.ID, viewer.ID, q)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	var nextCursor string
+	if len(entries) > 0 {
+		last := entries[len(entries)-1]
+
+		nextCursor, err = app.nextCursor(len(entries), q.Limit, last.FollowedAt, last.User.ID)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if err := app.paginatedJSONResponse(w, http.StatusOK, entries, nextCursor); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request) {
+	follower := getAuthUserFromContext(r)
+	followedUser := getUserFromContext(r)
+
+	if follower.ID == followedUser.ID {
+		app.badRequestError(w, r, errors.New("you cannot follow yourself"))
+		return
+	}
+
 	ctx := r.Context()
 
-	if err := app.store.Followers.Follow(ctx, followerUser.ID, payload.UserID); err != nil {
+	if followedUser.IsPrivate {
+		if err := app.store.Followers.RequestFollow(ctx, follower.ID, followedUser.ID); err != nil {
+			switch err {
+			case store.ErrConflict:
+				app.conflictError(w, r, err)
+			case store.ErrBlocked:
+				app.forbiddenResponse(w, r)
+			default:
+				app.internalServerError(w, r, err)
+			}
+
+			return
+		}
+
+		if err := app.jsonResponse(w, http.StatusAccepted, map[string]string{"status": "pending"}); err != nil {
+			app.internalServerError(w, r, err)
+		}
+
+		return
+	}
+
+	if err := app.store.Followers.Follow(ctx, follower.ID, followedUser.ID); err != nil {
 		switch err {
 		case store.ErrConflict:
 			app.conflictError(w, r, err)
+		case store.ErrBlocked:
+			app.forbiddenResponse(w, r)
 		default:
 			app.internalServerError(w, r, err)
 		}
@@ -56,21 +187,277 @@ func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request
 }
 
 func (app *application) unfollowUserHandler(w http.ResponseWriter, r *http.Request) {
-	unfollowerUser := getUserFromContext(r)
+	unfollower := getAuthUserFromContext(r)
+	unfollowedUser := getUserFromContext(r)
+
+	ctx := r.Context()
+
+	if err := app.store.Followers.Unfollow(ctx, unfollower.ID, unfollowedUser.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
 
-	var payload FollowUser
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+type updateUserSettingsPayload struct {
+	IsPrivate *bool `json:"is_private" validate:"required"`
+}
+
+func (app *application) updateUserSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromContext(r)
+
+	var payload updateUserSettingsPayload
 	if err := readJSON(w, r, &payload); err != nil {
 		app.badRequestError(w, r, err)
 		return
 	}
 
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user.IsPrivate = *payload.IsPrivate
+
+	if err := app.store.Users.UpdatePrivacy(r.Context(), user); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+type updateProfilePayload struct {
+	Username    *string `json:"username" validate:"omitempty,min=3,max=100,username"`
+	Email       *string `json:"email" validate:"omitempty,email,max=255"`
+	DisplayName *string `json:"display_name" validate:"omitempty,max=50"`
+	Bio         *string `json:"bio" validate:"omitempty,max=160"`
+	Website     *string `json:"website" validate:"omitempty,max=255,eq=|http_url"`
+	Location    *string `json:"location" validate:"omitempty,max=100"`
+	// AvatarMediaID is an image uploaded with POST /v1/media. Zero removes
+	// the avatar.
+	AvatarMediaID *int64 `json:"avatar_media_id" validate:"omitempty,gte=0"`
+}
+
+// updateProfileHandler edits the profile of the authenticated user. A new
+// email address is only used once it is confirmed through the link sent to
+// it, so the response reports it as pending. Should the change of address
+// fail once the rest of the profile is saved, the response says why in
+// email_error.
+func (app *application) updateProfileHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUserFromContext(r)
+
+	var payload updateProfilePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if payload.Username != nil {
+		user.Username = *payload.Username
+	}
+	if payload.DisplayName != nil {
+		user.DisplayName = *payload.DisplayName
+	}
+	if payload.Bio != nil {
+		user.Bio = *payload.Bio
+	}
+	if payload.Website != nil {
+		user.Website = *payload.Website
+	}
+	if payload.Location != nil {
+		user.Location = *payload.Location
+	}
+	if payload.AvatarMediaID != nil {
+		user.AvatarMediaID = payload.AvatarMediaID
+		if *payload.AvatarMediaID == 0 {
+			user.AvatarMediaID = nil
+		}
+	}
+
 	ctx := r.Context()
+	changeEmail := payload.Email != nil && !strings.EqualFold(*payload.Email, user.Email)
+
+	// A taken address rejects the whole request before anything is saved.
+	if changeEmail {
+		taken, err := app.store.Users.IsEmailTaken(ctx, *payload.Email)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if taken {
+			app.conflictError(w, r, store.ErrDuplicateEmail)
+			return
+		}
+	}
+
+	if err := app.store.Users.UpdateProfile(ctx, user, app.config.users.usernameCooldown); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFoundError(w, r, err)
+		case errors.Is(err, store.ErrDuplicateUsername):
+			app.conflictError(w, r, err)
+		case errors.Is(err, store.ErrUsernameCooldown):
+			app.badRequestError(w, r, fmt.Errorf("%w: it can be changed once every %s", err, app.config.users.usernameCooldown))
+		case errors.Is(err, store.ErrInvalidAvatar):
+			app.badRequestError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+
+		return
+	}
+
+	response := struct {
+		*store.User
+		PendingEmail string `json:"pending_email,omitempty"`
+		EmailError   string `json:"email_error,omitempty"`
+	}{}
+
+	// The profile is saved at this point, so the request succeeds even if
+	// the address cannot be changed.
+	if changeEmail {
+		err := app.requestEmailChange(ctx, user, *payload.Email)
+
+		switch {
+		case err == nil:
+			response.PendingEmail = *payload.Email
+		case errors.Is(err, store.ErrDuplicateEmail):
+			response.EmailError = err.Error()
+		default:
+			log.Printf("error requesting email change for user %d: %s", user.ID, err)
+			response.EmailError = "the email address could not be changed"
+		}
+	}
+
+	// Reload the user for the URL of their new avatar.
+	updated, err := app.store.Users.GetUserById(ctx, int(user.ID))
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
 
-	if err := app.store.Followers.Unfollow(ctx, unfollowerUser.ID, payload.UserID); err != nil {
+		return
+	}
+
+	response.User = updated
+
+	if err := app.jsonResponse(w, http.StatusOK, response); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// requestEmailChange sends a confirmation link to the new email address.
+func (app *application) requestEmailChange(ctx context.Context, user *store.User, email string) error {
+	plainToken, err := generateToken()
+	if err != nil {
+		return err
+	}
+
+	if err := app.store.Users.RequestEmailChange(ctx, user.ID, email, plainToken, app.config.mail.exp); err != nil {
+		return err
+	}
+
+	vars := struct {
+		Username        string
+		ConfirmationURL string
+	}{
+		Username:        user.Username,
+		ConfirmationURL: fmt.Sprintf("%s/confirm-email/%s", app.config.frontendURL, plainToken),
+	}
+
+	// Should sending fail, the request is simply never confirmed and is
+	// replaced by the next one.
+	return app.mailer.Send(mailer.EmailChangeTemplate, user.Username, email, vars)
+}
+
+func (app *application) confirmEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+
+	if err := app.store.Users.ConfirmEmailChange(r.Context(), token); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFoundError(w, r, err)
+		case errors.Is(err, store.ErrDuplicateEmail):
+			app.conflictError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getUserByUsernameHandler looks a user up by their username. Usernames the
+// user has since given up redirect to their profile.
+func (app *application) getUserByUsernameHandler(w http.ResponseWriter, r *http.Request) {
+	username := chi.URLParam(r, "username")
+	ctx := r.Context()
+
+	user, err := app.store.Users.GetByUsername(ctx, username)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+
+		return
+	}
+
+	if !strings.EqualFold(user.Username, username) {
+		http.Redirect(w, r, "/v1/users/"+strconv.FormatInt(user.ID, 10), http.StatusMovedPermanently)
+		return
+	}
+
+	viewer := getAuthUserFromContext(r)
+
+	profile, err := app.store.Users.GetProfile(ctx, user, viewer.ID)
+	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
+	if err := app.jsonResponse(w, http.StatusOK, profile); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+
+	if err := app.store.Users.Activate(r.Context(), token); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+
+		return
+	}
+
 	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -0,0 +1,4 @@
+ALTER TABLE comments
+ADD COLUMN parent_id BIGINT REFERENCES comments(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_comments_parent_id ON comments (parent_id);
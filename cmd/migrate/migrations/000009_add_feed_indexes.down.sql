@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_comments_post_id;
+
+DROP INDEX IF EXISTS idx_posts_tags;
+
+DROP INDEX IF EXISTS idx_posts_user_id_created_at;
+
+DROP INDEX IF EXISTS idx_followers_follower_id;
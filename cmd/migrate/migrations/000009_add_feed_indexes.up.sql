@@ -0,0 +1,7 @@
+CREATE INDEX IF NOT EXISTS idx_followers_follower_id ON followers (follower_id, user_id);
+
+CREATE INDEX IF NOT EXISTS idx_posts_user_id_created_at ON posts (user_id, created_at DESC, id DESC);
+
+CREATE INDEX IF NOT EXISTS idx_posts_tags ON posts USING gin (tags);
+
+CREATE INDEX IF NOT EXISTS idx_comments_post_id ON comments (post_id);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS timelines (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    post_id BIGINT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (user_id, post_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_timelines_user_id_created_at ON timelines (user_id, created_at DESC, post_id DESC);
@@ -0,0 +1,9 @@
+ALTER TABLE users
+ADD COLUMN is_private BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS follow_requests (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    requester_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, requester_id)
+);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS reposts;
+
+ALTER TABLE posts
+DROP COLUMN IF EXISTS quoted_post_id;
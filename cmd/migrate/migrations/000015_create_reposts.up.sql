@@ -0,0 +1,12 @@
+ALTER TABLE posts
+ADD COLUMN quoted_post_id BIGINT REFERENCES posts(id) ON DELETE SET NULL;
+
+CREATE TABLE IF NOT EXISTS reposts (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    post_id BIGINT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, post_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_reposts_post_id_created_at ON reposts (post_id, created_at DESC, user_id DESC);
+CREATE INDEX IF NOT EXISTS idx_reposts_user_id_created_at ON reposts (user_id, created_at DESC);
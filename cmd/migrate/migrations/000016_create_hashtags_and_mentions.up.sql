@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS post_hashtags (
+    post_id BIGINT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    tag VARCHAR(100) NOT NULL,
+    PRIMARY KEY (post_id, tag)
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_hashtags_tag ON post_hashtags (tag);
+
+CREATE TABLE IF NOT EXISTS post_mentions (
+    post_id BIGINT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    PRIMARY KEY (post_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_mentions_user_id ON post_mentions (user_id);
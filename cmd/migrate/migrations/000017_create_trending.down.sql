@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS trending_tags;
+
+DROP TABLE IF EXISTS trending_posts;
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS trending_posts (
+    period VARCHAR(3) NOT NULL,
+    post_id BIGINT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    score DOUBLE PRECISION NOT NULL,
+    computed_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (period, post_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_trending_posts_period_score ON trending_posts (period, score DESC);
+
+CREATE TABLE IF NOT EXISTS trending_tags (
+    period VARCHAR(3) NOT NULL,
+    tag VARCHAR(100) NOT NULL,
+    score DOUBLE PRECISION NOT NULL,
+    posts_count INT NOT NULL,
+    computed_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (period, tag)
+);
+
+CREATE INDEX IF NOT EXISTS idx_trending_tags_period_score ON trending_tags (period, score DESC);
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_users_search_vector;
+
+ALTER TABLE users
+DROP COLUMN IF EXISTS search_vector;
+
+DROP INDEX IF EXISTS idx_posts_search_vector;
+
+ALTER TABLE posts
+DROP COLUMN IF EXISTS search_vector;
@@ -0,0 +1,14 @@
+ALTER TABLE posts
+ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(content, '')), 'B')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_posts_search_vector ON posts USING gin (search_vector);
+
+ALTER TABLE users
+ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    to_tsvector('simple', username)
+) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_users_search_vector ON users USING gin (search_vector);
@@ -0,0 +1,8 @@
+DROP TRIGGER IF EXISTS notifications_stream_event ON notifications;
+DROP TRIGGER IF EXISTS comments_stream_event ON comments;
+DROP TRIGGER IF EXISTS posts_stream_event ON posts;
+
+DROP FUNCTION IF EXISTS stream_notification_created();
+DROP FUNCTION IF EXISTS stream_comment_created();
+DROP FUNCTION IF EXISTS stream_post_created();
+DROP FUNCTION IF EXISTS notify_stream_event(TEXT, TEXT, BIGINT);
@@ -0,0 +1,52 @@
+-- Only the id of the row is published: NOTIFY payloads are limited to 8000
+-- bytes and the listener loads the row itself.
+CREATE OR REPLACE FUNCTION notify_stream_event(event_topic TEXT, event_type TEXT, event_id BIGINT) RETURNS VOID AS $$
+BEGIN
+    PERFORM pg_notify('stream_events', json_build_object(
+        'topic', event_topic,
+        'type', event_type,
+        'id', event_id
+    )::text);
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION stream_post_created() RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM notify_stream_event('author:' || NEW.user_id, 'post', NEW.id);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION stream_comment_created() RETURNS TRIGGER AS $$
+DECLARE
+    post_author BIGINT;
+BEGIN
+    SELECT user_id INTO post_author FROM posts WHERE id = NEW.post_id;
+
+    IF post_author IS NOT NULL AND post_author <> NEW.user_id AND NOT EXISTS (
+        SELECT 1 FROM user_blocks ub
+        WHERE (ub.blocker_id = post_author AND ub.blocked_id = NEW.user_id)
+            OR (ub.blocker_id = NEW.user_id AND ub.blocked_id = post_author)
+    ) THEN
+        PERFORM notify_stream_event('user:' || post_author, 'comment', NEW.id);
+    END IF;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION stream_notification_created() RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM notify_stream_event('user:' || NEW.user_id, 'notification', NEW.id);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER posts_stream_event AFTER INSERT ON posts
+FOR EACH ROW EXECUTE FUNCTION stream_post_created();
+
+CREATE TRIGGER comments_stream_event AFTER INSERT ON comments
+FOR EACH ROW EXECUTE FUNCTION stream_comment_created();
+
+CREATE TRIGGER notifications_stream_event AFTER INSERT ON notifications
+FOR EACH ROW EXECUTE FUNCTION stream_notification_created();
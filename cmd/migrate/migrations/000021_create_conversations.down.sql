@@ -0,0 +1,9 @@
+DROP TRIGGER IF EXISTS messages_stream_event ON messages;
+
+DROP FUNCTION IF EXISTS stream_message_created();
+
+DROP TABLE IF EXISTS messages;
+
+DROP TABLE IF EXISTS conversation_members;
+
+DROP TABLE IF EXISTS conversations;
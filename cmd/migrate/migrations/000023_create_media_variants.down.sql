@@ -0,0 +1,15 @@
+DROP TABLE IF EXISTS media_variants;
+
+DROP INDEX IF EXISTS idx_media_unprocessed;
+
+DELETE FROM media WHERE url IS NULL;
+
+ALTER TABLE media
+    ALTER COLUMN url SET NOT NULL,
+    DROP COLUMN IF EXISTS status,
+    DROP COLUMN IF EXISTS attempts,
+    DROP COLUMN IF EXISTS next_attempt_at,
+    DROP COLUMN IF EXISTS claimed_at,
+    DROP COLUMN IF EXISTS width,
+    DROP COLUMN IF EXISTS height,
+    DROP COLUMN IF EXISTS blurhash;
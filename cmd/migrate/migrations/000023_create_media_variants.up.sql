@@ -0,0 +1,27 @@
+-- Images are processed in the background. Their url stays empty until the
+-- copy stripped of its metadata is stored.
+ALTER TABLE media
+    ALTER COLUMN url DROP NOT NULL,
+    ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'ready' CHECK (status IN ('pending', 'processing', 'ready', 'failed')),
+    ADD COLUMN attempts INT NOT NULL DEFAULT 0,
+    ADD COLUMN next_attempt_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    ADD COLUMN claimed_at TIMESTAMP(0) WITH TIME ZONE,
+    ADD COLUMN width INT,
+    ADD COLUMN height INT,
+    ADD COLUMN blurhash TEXT;
+
+UPDATE media SET status = 'pending' WHERE kind = 'image';
+
+CREATE INDEX IF NOT EXISTS idx_media_unprocessed ON media (next_attempt_at) WHERE status IN ('pending', 'processing');
+
+CREATE TABLE IF NOT EXISTS media_variants (
+    media_id BIGINT NOT NULL REFERENCES media(id) ON DELETE CASCADE,
+    name VARCHAR(20) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    width INT NOT NULL,
+    height INT NOT NULL,
+    storage_key TEXT NOT NULL UNIQUE,
+    url TEXT NOT NULL,
+    PRIMARY KEY (media_id, name)
+);
@@ -0,0 +1,13 @@
+DROP TABLE IF EXISTS email_changes;
+
+DROP TABLE IF EXISTS username_redirects;
+
+DROP INDEX IF EXISTS idx_users_username_lower;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS display_name,
+    DROP COLUMN IF EXISTS bio,
+    DROP COLUMN IF EXISTS website,
+    DROP COLUMN IF EXISTS location,
+    DROP COLUMN IF EXISTS avatar_media_id,
+    DROP COLUMN IF EXISTS username_changed_at;
@@ -0,0 +1,32 @@
+ALTER TABLE users
+    ADD COLUMN display_name VARCHAR(50) NOT NULL DEFAULT '',
+    ADD COLUMN bio VARCHAR(160) NOT NULL DEFAULT '',
+    ADD COLUMN website VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN location VARCHAR(100) NOT NULL DEFAULT '',
+    ADD COLUMN avatar_media_id BIGINT REFERENCES media(id) ON DELETE SET NULL,
+    ADD COLUMN username_changed_at TIMESTAMP(0) WITH TIME ZONE;
+
+-- Usernames are compared case-insensitively, which the unique constraint on
+-- the column alone does not enforce.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username_lower ON users (lower(username));
+
+-- Old usernames keep pointing to the user who gave them up, and cannot be
+-- claimed by anyone else.
+CREATE TABLE IF NOT EXISTS username_redirects (
+    old_username VARCHAR(255) PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_username_redirects_lower ON username_redirects (lower(old_username));
+CREATE INDEX IF NOT EXISTS idx_username_redirects_user_id ON username_redirects (user_id);
+
+-- A new email address only replaces the current one once it is verified.
+CREATE TABLE IF NOT EXISTS email_changes (
+    token bytea PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email citext NOT NULL,
+    expiry TIMESTAMP(0) WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_changes_user_id ON email_changes (user_id);
@@ -0,0 +1,24 @@
+// Package blob stores uploaded files such as media attachments.
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+var (
+	ErrInvalidKey = errors.New("invalid blob key")
+	ErrNotFound   = errors.New("blob not found")
+)
+
+// BlobStore saves and removes blobs by key. Keys are slash separated paths
+// made of URL safe characters.
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens the blob for reading. The caller must close it.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	// URL returns the public address the blob can be downloaded from.
+	URL(key string) string
+}
@@ -0,0 +1,300 @@
+package blob
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testAccessKey = "AKIDEXAMPLE"
+	testSecretKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+	testRegion    = "us-east-1"
+	testBucket    = "media"
+)
+
+// fakeS3 is an in-memory bucket that only accepts requests signed with the
+// test credentials.
+type fakeS3 struct {
+	t *testing.T
+
+	mu       sync.Mutex
+	objects  map[string]fakeObject
+	requests []string
+	// status, when set, is returned for every request instead.
+	status int
+}
+
+type fakeObject struct {
+	data        []byte
+	contentType string
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *S3Store) {
+	t.Helper()
+
+	fake := &fakeS3{t: t, objects: map[string]fakeObject{}}
+
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	s, err := NewS3Store(S3Config{
+		Endpoint:  srv.URL + "/",
+		Region:    testRegion,
+		Bucket:    testBucket,
+		AccessKey: testAccessKey,
+		SecretKey: testSecretKey,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return fake, s
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+
+	if err := verifySignature(r); err != nil {
+		f.t.Errorf("%s %s: %s", r.Method, r.URL.Path, err)
+		http.Error(w, "SignatureDoesNotMatch", http.StatusForbidden)
+		return
+	}
+
+	if f.status != 0 {
+		http.Error(w, "<Error><Code>SlowDown</Code></Error>", f.status)
+		return
+	}
+
+	// Path-style addressing puts the bucket in the path.
+	key, ok := strings.CutPrefix(r.URL.Path, "/"+testBucket+"/")
+	if !ok {
+		http.Error(w, "NoSuchBucket", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if r.ContentLength != int64(len(data)) {
+			f.t.Errorf("PUT %s: content length %d, body of %d bytes", key, r.ContentLength, len(data))
+		}
+
+		f.objects[key] = fakeObject{data, r.Header.Get("Content-Type")}
+	case http.MethodGet:
+		obj, ok := f.objects[key]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", obj.contentType)
+		w.Write(obj.data)
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// verifySignature checks the Signature Version 4 headers of r the way S3
+// does, from what reached the server.
+func verifySignature(r *http.Request) error {
+	amzDate := r.Header.Get("X-Amz-Date")
+
+	now, err := time.Parse("20060102T150405Z", amzDate)
+	if err != nil {
+		return errors.New("missing or invalid X-Amz-Date")
+	}
+
+	if d := time.Since(now); d > time.Minute || d < -time.Minute {
+		return errors.New("X-Amz-Date is not current")
+	}
+
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash != "UNSIGNED-PAYLOAD" {
+		return errors.New("X-Amz-Content-Sha256 is not UNSIGNED-PAYLOAD")
+	}
+
+	date := amzDate[:8]
+	scope := date + "/" + testRegion + "/s3/aws4_request"
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+
+	canonicalRequest := r.Method + "\n" +
+		r.URL.EscapedPath() + "\n" +
+		r.URL.RawQuery + "\n" +
+		"host:" + r.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n" +
+		"\n" +
+		signedHeaders + "\n" +
+		payloadHash
+
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + testSecretKey)
+	for _, part := range []string{date, testRegion, "s3", "aws4_request"} {
+		key = testHMAC(key, part)
+	}
+
+	want := "AWS4-HMAC-SHA256 Credential=" + testAccessKey + "/" + scope +
+		", SignedHeaders=" + signedHeaders +
+		", Signature=" + hex.EncodeToString(testHMAC(key, stringToSign))
+
+	if got := r.Header.Get("Authorization"); got != want {
+		return errors.New("Authorization = " + got + ", want " + want)
+	}
+
+	return nil
+}
+
+func testHMAC(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func TestS3Store(t *testing.T) {
+	fake, s := newFakeS3(t)
+	ctx := context.Background()
+
+	key := "uploads/42/photo one.jpg"
+	data := "not really a jpeg"
+
+	if err := s.Put(ctx, key, strings.NewReader(data), int64(len(data)), "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+
+	if obj := fake.objects[key]; string(obj.data) != data || obj.contentType != "image/jpeg" {
+		t.Fatalf("stored %q as %q, want %q as image/jpeg", obj.data, obj.contentType, data)
+	}
+
+	r, err := s.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := io.ReadAll(r)
+	r.Close()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(got) != data {
+		t.Errorf("Get = %q, want %q", got, data)
+	}
+
+	if err := s.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete: err = %v, want ErrNotFound", err)
+	}
+
+	want := []string{
+		"PUT /media/uploads/42/photo one.jpg",
+		"GET /media/uploads/42/photo one.jpg",
+		"DELETE /media/uploads/42/photo one.jpg",
+		"GET /media/uploads/42/photo one.jpg",
+	}
+
+	if strings.Join(fake.requests, "\n") != strings.Join(want, "\n") {
+		t.Errorf("requests = %q, want %q", fake.requests, want)
+	}
+}
+
+func TestS3StoreErrors(t *testing.T) {
+	fake, s := newFakeS3(t)
+	ctx := context.Background()
+
+	fake.status = http.StatusServiceUnavailable
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{"put", func() error {
+			return s.Put(ctx, "a.jpg", strings.NewReader("a"), 1, "image/jpeg")
+		}},
+		{"get", func() error {
+			_, err := s.Get(ctx, "a.jpg")
+			return err
+		}},
+		{"delete", func() error {
+			return s.Delete(ctx, "a.jpg")
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+			if err == nil {
+				t.Fatal("err = nil, want an error")
+			}
+
+			if errors.Is(err, ErrNotFound) {
+				t.Fatal("a 503 was reported as ErrNotFound")
+			}
+
+			if !strings.Contains(err.Error(), "503") || !strings.Contains(err.Error(), "SlowDown") {
+				t.Errorf("err = %q, want the status and the body", err)
+			}
+		})
+	}
+}
+
+func TestS3StoreInvalidKey(t *testing.T) {
+	fake, s := newFakeS3(t)
+
+	for _, key := range []string{"", "/a.jpg", "../a.jpg", "a/../../b.jpg"} {
+		if _, err := s.Get(context.Background(), key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Get(%q): err = %v, want ErrInvalidKey", key, err)
+		}
+	}
+
+	if len(fake.requests) != 0 {
+		t.Errorf("requests = %q, want none", fake.requests)
+	}
+}
+
+func TestS3StoreURL(t *testing.T) {
+	s, err := NewS3Store(S3Config{Endpoint: "http://localhost:9000/", Bucket: testBucket})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := s.URL("a/b.jpg"), "http://localhost:9000/media/a/b.jpg"; got != want {
+		t.Errorf("URL = %q, want %q", got, want)
+	}
+
+	s, err = NewS3Store(S3Config{Endpoint: "http://localhost:9000", Bucket: testBucket, PublicURL: "https://cdn.example.com/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := s.URL("a/b.jpg"), "https://cdn.example.com/a/b.jpg"; got != want {
+		t.Errorf("URL = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,75 @@
+package cursor
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"social/social/internal/store"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+type payload struct {
+	CreatedAt time.Time `json:"t"`
+	ID        int64     `json:"id"`
+}
+
+// Signer turns keyset positions into opaque tokens that clients cannot
+// forge or tamper with, and back.
+type Signer struct {
+	secret []byte
+}
+
+func NewSigner(secret string) *Signer {
+	return &Signer{[]byte(secret)}
+}
+
+func (s *Signer) Encode(c store.Cursor) (string, error) {
+	data, err := json.Marshal(payload{c.CreatedAt, c.ID})
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(data) + "." + enc.EncodeToString(s.sign(data)), nil
+}
+
+func (s *Signer) Decode(token string) (store.Cursor, error) {
+	enc := base64.RawURLEncoding
+
+	data, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return store.Cursor{}, ErrInvalidCursor
+	}
+
+	rawData, err := enc.DecodeString(data)
+	if err != nil {
+		return store.Cursor{}, ErrInvalidCursor
+	}
+
+	rawSig, err := enc.DecodeString(sig)
+	if err != nil {
+		return store.Cursor{}, ErrInvalidCursor
+	}
+
+	if !hmac.Equal(rawSig, s.sign(rawData)) {
+		return store.Cursor{}, ErrInvalidCursor
+	}
+
+	var p payload
+	if err := json.Unmarshal(rawData, &p); err != nil {
+		return store.Cursor{}, ErrInvalidCursor
+	}
+
+	return store.Cursor{CreatedAt: p.CreatedAt, ID: p.ID}, nil
+}
+
+func (s *Signer) sign(data []byte) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
@@ -135,6 +135,7 @@ func generateUsers(num int) []*store.User {
 			Username: usernames[i%len(usernames)] + fmt.Sprintf("%d", i),
 			Email:    usernames[i%len(usernames)] + fmt.Sprintf("%d", i) + "@example.com",
 			Password: "123123",
+			IsActive: true,
 		}
 	}
 
@@ -0,0 +1,65 @@
+// Package extract pulls #hashtags and @mentions out of post content.
+package extract
+
+import (
+	"regexp"
+	"strings"
+)
+
+// MaxLength is the longest hashtag or mention that is recognised, matching
+// the longest username accepted at registration.
+const MaxLength = 100
+
+var (
+	// A marker only starts an entity at the beginning of the text or after a
+	// character that cannot be part of a word, so that e.g. emails are not
+	// taken for mentions.
+	hashtagRegex = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_#@&])#([\p{L}\p{N}_]+)`)
+	mentionRegex = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_#@.])@([\p{L}\p{N}_.]+)`)
+
+	usernameRegex = regexp.MustCompile(`^[\p{L}\p{N}_.]*[\p{L}\p{N}_]$`)
+)
+
+// IsMentionable reports whether username can be mentioned in full, i.e.
+// whether it only has the characters a mention is made of and does not end
+// with a dot.
+func IsMentionable(username string) bool {
+	return len([]rune(username)) <= MaxLength && usernameRegex.MatchString(username)
+}
+
+// Hashtags returns the normalised, de-duplicated hashtags found in text in the
+// order they first appear.
+func Hashtags(text string) []string {
+	return find(hashtagRegex, text)
+}
+
+// Mentions returns the normalised, de-duplicated usernames mentioned in text
+// in the order they first appear.
+func Mentions(text string) []string {
+	return find(mentionRegex, text)
+}
+
+// NormalizeTag turns a hashtag as typed by a user, with or without the
+// leading #, into the form it is stored in.
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+}
+
+func find(re *regexp.Regexp, text string) []string {
+	seen := map[string]bool{}
+	found := []string{}
+
+	for _, match := range re.FindAllStringSubmatch(text, -1) {
+		// A trailing dot is sentence punctuation rather than part of a
+		// username.
+		entity := strings.ToLower(strings.TrimRight(match[1], "."))
+		if entity == "" || len([]rune(entity)) > MaxLength || seen[entity] {
+			continue
+		}
+
+		seen[entity] = true
+		found = append(found, entity)
+	}
+
+	return found
+}
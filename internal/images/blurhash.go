@@ -0,0 +1,122 @@
+package images
+
+import (
+	"image"
+	"math"
+	"strings"
+)
+
+const base83 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// blurhash encodes the image as a BlurHash (https://blurha.sh) with the given
+// number of horizontal and vertical components, between 1 and 9. Clients
+// render it as a placeholder while the image loads. The image should be
+// small, as every pixel is visited once per component.
+func blurhash(img image.Image, xComponents, yComponents int) string {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	factors := make([][3]float64, 0, xComponents*yComponents)
+
+	for j := range yComponents {
+		for i := range xComponents {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+
+			var factor [3]float64
+
+			for y := range height {
+				for x := range width {
+					basis := normalisation *
+						math.Cos(math.Pi*float64(i)*float64(x)/float64(width)) *
+						math.Cos(math.Pi*float64(j)*float64(y)/float64(height))
+
+					r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+
+					factor[0] += basis * srgbToLinear(r>>8)
+					factor[1] += basis * srgbToLinear(g>>8)
+					factor[2] += basis * srgbToLinear(b>>8)
+				}
+			}
+
+			scale := 1 / float64(width*height)
+			for c := range factor {
+				factor[c] *= scale
+			}
+
+			factors = append(factors, factor)
+		}
+	}
+
+	var hash strings.Builder
+
+	encode83(&hash, (xComponents-1)+(yComponents-1)*9, 1)
+
+	dc, ac := factors[0], factors[1:]
+
+	maximum := 1.0
+	if len(ac) > 0 {
+		actualMaximum := 0.0
+		for _, factor := range ac {
+			for _, v := range factor {
+				actualMaximum = math.Max(actualMaximum, math.Abs(v))
+			}
+		}
+
+		quantisedMaximum := int(math.Max(0, math.Min(82, math.Floor(actualMaximum*166-0.5))))
+		maximum = float64(quantisedMaximum+1) / 166
+
+		encode83(&hash, quantisedMaximum, 1)
+	} else {
+		encode83(&hash, 0, 1)
+	}
+
+	encode83(&hash, linearToSRGB(dc[0])<<16+linearToSRGB(dc[1])<<8+linearToSRGB(dc[2]), 4)
+
+	for _, factor := range ac {
+		quantised := [3]int{}
+		for c, v := range factor {
+			quantised[c] = int(math.Max(0, math.Min(18, math.Floor(signPow(v/maximum, 0.5)*9+9.5))))
+		}
+
+		encode83(&hash, quantised[0]*19*19+quantised[1]*19+quantised[2], 2)
+	}
+
+	return hash.String()
+}
+
+func encode83(sb *strings.Builder, value, length int) {
+	divisor := 1
+	for range length - 1 {
+		divisor *= 83
+	}
+
+	for range length {
+		sb.WriteByte(base83[(value/divisor)%83])
+		divisor /= 83
+	}
+}
+
+func srgbToLinear(value uint32) float64 {
+	v := float64(value) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(value float64) int {
+	v := math.Max(0, math.Min(1, value))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(value, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(value), exp), value)
+}
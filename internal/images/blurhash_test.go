@@ -0,0 +1,117 @@
+package images
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func newTestImage(width, height int, at func(x, y int) color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := range height {
+		for x := range width {
+			img.SetRGBA(x, y, at(x, y))
+		}
+	}
+
+	return img
+}
+
+// The expected hashes come from the reference encoder
+// (https://github.com/woltapp/blurhash, encode.ts) run on the same pixels.
+func TestBlurhash(t *testing.T) {
+	white := color.RGBA{255, 255, 255, 255}
+	black := color.RGBA{0, 0, 0, 255}
+
+	tests := []struct {
+		name                     string
+		img                      image.Image
+		xComponents, yComponents int
+		want                     string
+	}{
+		{
+			name:        "white",
+			img:         newTestImage(1, 1, func(x, y int) color.RGBA { return white }),
+			xComponents: 1,
+			yComponents: 1,
+			want:        "00TSUA",
+		},
+		{
+			name:        "black",
+			img:         newTestImage(1, 1, func(x, y int) color.RGBA { return black }),
+			xComponents: 1,
+			yComponents: 1,
+			want:        "000000",
+		},
+		{
+			name: "gradient",
+			img: newTestImage(32, 32, func(x, y int) color.RGBA {
+				return color.RGBA{uint8(x * 8), uint8(y * 8), 128, 255}
+			}),
+			xComponents: 4,
+			yComponents: 3,
+			want:        "LxH2cX2swxX8l}WDjte;gJfjfQfj",
+		},
+		{
+			name: "checker",
+			img: newTestImage(32, 32, func(x, y int) color.RGBA {
+				if (x/16+y/16)%2 == 0 {
+					return color.RGBA{255, 0, 0, 255}
+				}
+
+				return color.RGBA{0, 0, 255, 255}
+			}),
+			xComponents: 4,
+			yComponents: 3,
+			want:        "L+LjfLsXfQsXsX|TsRJqfQsRjsWr",
+		},
+		{
+			name: "stripes",
+			img: newTestImage(32, 16, func(x, y int) color.RGBA {
+				if (x/4)%2 == 0 {
+					return white
+				}
+
+				return black
+			}),
+			xComponents: 9,
+			yComponents: 1,
+			want:        "8^Lqe9%MfQ%MfQ-;fQ~q?b",
+		},
+		{
+			name: "portrait",
+			img: newTestImage(16, 32, func(x, y int) color.RGBA {
+				if y < 24 {
+					return color.RGBA{200, 100, 50, 255}
+				}
+
+				return color.RGBA{20, 40, 80, 255}
+			}),
+			xComponents: 3,
+			yComponents: 5,
+			want:        "clKHqAxFfQ}ToJfQAHWWfQ$gj@fQsmjtfQ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := blurhash(tt.img, tt.xComponents, tt.yComponents); got != tt.want {
+				t.Errorf("blurhash = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlurhashSubImage(t *testing.T) {
+	img := newTestImage(48, 48, func(x, y int) color.RGBA {
+		return color.RGBA{uint8((x - 16) * 8), uint8((y - 16) * 8), 128, 255}
+	})
+
+	// Bounds that do not start at the origin must not shift the image.
+	sub := img.SubImage(image.Rect(16, 16, 48, 48))
+
+	if got, want := blurhash(sub, 4, 3), "LxH2cX2swxX8l}WDjte;gJfjfQfj"; got != want {
+		t.Errorf("blurhash = %q, want %q", got, want)
+	}
+}
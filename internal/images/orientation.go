@@ -0,0 +1,133 @@
+package images
+
+import (
+	"encoding/binary"
+	"image"
+)
+
+// jpegOrientation returns the EXIF orientation of a JPEG, between 1 and 8.
+// It is 1, the identity, when the image has none. Cameras store the picture
+// the way the sensor saw it and only record how to turn it, so the rotation
+// has to be applied before the metadata is dropped.
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+
+		marker := data[i+1]
+
+		// The metadata segments all come before the image data.
+		if marker == 0xDA || marker == 0xD9 {
+			return 1
+		}
+
+		size := int(binary.BigEndian.Uint16(data[i+2:]))
+		if size < 2 || i+2+size > len(data) {
+			return 1
+		}
+
+		if marker == 0xE1 {
+			if o := exifOrientation(data[i+4 : i+2+size]); o != 0 {
+				return o
+			}
+		}
+
+		i += 2 + size
+	}
+
+	return 1
+}
+
+// exifOrientation reads the orientation tag from the first image file
+// directory of an APP1 segment. It returns 0 when there is none.
+func exifOrientation(segment []byte) int {
+	if len(segment) < 14 || string(segment[:6]) != "Exif\x00\x00" {
+		return 0
+	}
+
+	tiff := segment[6:]
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0
+	}
+
+	entries := int(order.Uint16(tiff[ifd:]))
+
+	for n := range entries {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+
+		if order.Uint16(tiff[entry:]) != 0x0112 {
+			continue
+		}
+
+		if o := int(order.Uint16(tiff[entry+8:])); o >= 1 && o <= 8 {
+			return o
+		}
+
+		return 0
+	}
+
+	return 0
+}
+
+// orient turns the image upright according to its EXIF orientation.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	// Orientations 5 to 8 swap the sides.
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	if orientation >= 5 {
+		dst = image.NewRGBA(image.Rect(0, 0, height, width))
+	}
+
+	for y := range height {
+		for x := range width {
+			var dx, dy int
+
+			switch orientation {
+			case 2: // mirrored horizontally
+				dx, dy = width-1-x, y
+			case 3: // rotated 180°
+				dx, dy = width-1-x, height-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, height-1-y
+			case 5: // transposed
+				dx, dy = y, x
+			case 6: // rotated 90° clockwise
+				dx, dy = height-1-y, x
+			case 7: // transversed
+				dx, dy = height-1-y, width-1-x
+			case 8: // rotated 90° counter-clockwise
+				dx, dy = y, width-1-x
+			}
+
+			dst.Set(dx, dy, img.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+
+	return dst
+}
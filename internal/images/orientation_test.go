@@ -0,0 +1,194 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// exifSegment returns an APP1 segment holding a single image file directory
+// with the given tag and value.
+func exifSegment(order binary.ByteOrder, tag, value uint16) []byte {
+	tiff := make([]byte, 8+2+12+4)
+
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 1)
+
+	entry := tiff[10:]
+	order.PutUint16(entry, tag)
+	order.PutUint16(entry[2:], 3) // SHORT
+	order.PutUint32(entry[4:], 1)
+	order.PutUint16(entry[8:], value)
+
+	return appSegment(0xE1, append([]byte("Exif\x00\x00"), tiff...))
+}
+
+func appSegment(marker byte, payload []byte) []byte {
+	segment := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+
+	return append(segment, payload...)
+}
+
+// testJPEG encodes a 3x2 image and inserts the segments right after the
+// start of image marker, where cameras write their metadata.
+func testJPEG(t *testing.T, segments ...[]byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 3, 2)), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buf.Bytes()
+
+	out := append([]byte{}, data[:2]...)
+	for _, segment := range segments {
+		out = append(out, segment...)
+	}
+
+	return append(out, data[2:]...)
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	for o := range 8 {
+		o := uint16(o + 1)
+
+		for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+			data := testJPEG(t, exifSegment(order, 0x0112, o))
+
+			if got := jpegOrientation(data); got != int(o) {
+				t.Errorf("%s orientation %d: got %d", order, o, got)
+			}
+
+			img, err := jpeg.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("%s orientation %d: %s", order, o, err)
+			}
+
+			// Orientations 5 to 8 swap the sides.
+			want := image.Pt(3, 2)
+			if o >= 5 {
+				want = image.Pt(2, 3)
+			}
+
+			if got := orient(img, int(o)).Bounds().Size(); got != want {
+				t.Errorf("%s orientation %d: size %v, want %v", order, o, got, want)
+			}
+		}
+	}
+}
+
+func TestJPEGOrientationMalformed(t *testing.T) {
+	valid := exifSegment(binary.BigEndian, 0x0112, 6)
+	xmp := appSegment(0xE1, []byte("http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta/>"))
+
+	// The segment declares more bytes than the file holds.
+	truncated := testJPEG(t)[:2]
+	truncated = append(truncated, valid[:len(valid)-4]...)
+
+	badOrder := exifSegment(binary.BigEndian, 0x0112, 6)
+	copy(badOrder[10:], "XX")
+
+	badIFD := exifSegment(binary.BigEndian, 0x0112, 6)
+	binary.BigEndian.PutUint32(badIFD[14:], 1000)
+
+	// The first entry is another tag, so the next one is read past the end.
+	tooManyEntries := exifSegment(binary.BigEndian, 0x010F, 6)
+	binary.BigEndian.PutUint16(tooManyEntries[18:], 50)
+
+	shortSize := testJPEG(t)[:2]
+	shortSize = append(shortSize, 0xFF, 0xE1, 0x00, 0x01)
+
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"empty", nil, 1},
+		{"not a jpeg", []byte("\x89PNG\r\n\x1a\n"), 1},
+		{"no exif", testJPEG(t), 1},
+		{"truncated segment", truncated, 1},
+		{"segment size below its own length", shortSize, 1},
+		{"missing marker", append(testJPEG(t)[:2], 0x00, 0xE1, 0x00, 0x04, 0, 0), 1},
+		{"not exif", testJPEG(t, appSegment(0xE1, []byte("Exif"))), 1},
+		{"invalid byte order", testJPEG(t, badOrder), 1},
+		{"directory out of bounds", testJPEG(t, badIFD), 1},
+		{"entries out of bounds", testJPEG(t, tooManyEntries), 1},
+		{"no orientation tag", testJPEG(t, exifSegment(binary.BigEndian, 0x010F, 6)), 1},
+		{"orientation 0", testJPEG(t, exifSegment(binary.BigEndian, 0x0112, 0)), 1},
+		{"orientation 9", testJPEG(t, exifSegment(binary.BigEndian, 0x0112, 9)), 1},
+		{"xmp before exif", testJPEG(t, xmp, valid), 6},
+		{"exif after the image data", append(testJPEG(t, appSegment(0xDA, nil)), valid...), 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jpegOrientation(tt.data); got != tt.want {
+				t.Errorf("jpegOrientation = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// a b c
+	// d e f
+	src := image.NewGray(image.Rect(0, 0, 3, 2))
+	for i, v := range []uint8{'a', 'b', 'c', 'd', 'e', 'f'} {
+		src.SetGray(i%3, i/3, color.Gray{v})
+	}
+
+	tests := []struct {
+		orientation int
+		want        []string
+	}{
+		{1, []string{"abc", "def"}},
+		{2, []string{"cba", "fed"}},
+		{3, []string{"fed", "cba"}},
+		{4, []string{"def", "abc"}},
+		{5, []string{"ad", "be", "cf"}},
+		{6, []string{"da", "eb", "fc"}},
+		{7, []string{"fc", "eb", "da"}},
+		{8, []string{"cf", "be", "ad"}},
+		{0, []string{"abc", "def"}},
+		{9, []string{"abc", "def"}},
+	}
+
+	for _, tt := range tests {
+		img := orient(src, tt.orientation)
+		bounds := img.Bounds()
+
+		var got []string
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			var row []byte
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				row = append(row, color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y)
+			}
+
+			got = append(got, string(row))
+		}
+
+		if len(got) != len(tt.want) {
+			t.Errorf("orientation %d: got %q, want %q", tt.orientation, got, tt.want)
+			continue
+		}
+
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("orientation %d: got %q, want %q", tt.orientation, got, tt.want)
+				break
+			}
+		}
+	}
+}
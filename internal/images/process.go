@@ -0,0 +1,192 @@
+package images
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"path"
+	"social/social/internal/store"
+	"strings"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// ErrUnsupported is returned for images that can never be processed, so
+// there is no point in retrying them.
+var ErrUnsupported = errors.New("unsupported image")
+
+// maxPixels protects the workers from images that decode into more memory
+// than they are worth.
+const maxPixels = 50_000_000
+
+// variants are rendered for every image. A variant that would not be smaller
+// than the image itself is skipped, except for the thumbnail which is always
+// a square.
+var variants = []struct {
+	name string
+	size int
+	crop bool
+}{
+	{"thumbnail", 200, true},
+	{"small", 640, false},
+	{"large", 1280, false},
+}
+
+type encoded struct {
+	data        []byte
+	contentType string
+	ext         string
+}
+
+// process stores a copy of the image without its metadata in place of the
+// upload, along with the variants, and fills in the fields of media that
+// depend on the image.
+func (p *Processor) process(ctx context.Context, media *store.Media) ([]store.MediaVariant, error) {
+	r, err := p.blobs.Get(ctx, media.StorageKey)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(r)
+	r.Close()
+
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, err)
+	}
+
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, fmt.Errorf("%w: %dx%d is too large", ErrUnsupported, cfg.Width, cfg.Height)
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, err)
+	}
+
+	if format == "jpeg" {
+		img = orient(img, jpegOrientation(data))
+	}
+
+	// Re-encoding drops the metadata. GIFs are kept as they are, since they
+	// carry no EXIF and re-encoding would lose their animation.
+	original := encoded{data, "image/gif", ".gif"}
+	if format != "gif" {
+		original, err = encode(img, format)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	base := strings.TrimSuffix(media.StorageKey, path.Ext(media.StorageKey))
+	key := base + "_original" + original.ext
+
+	if err := p.put(ctx, key, original); err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	url := p.blobs.URL(key)
+	hash := blurhash(resize(img, 32, false), 4, 3)
+
+	media.ContentType = original.contentType
+	media.Size = int64(len(original.data))
+	media.StorageKey = key
+	media.URL = &url
+	media.Width = &width
+	media.Height = &height
+	media.Blurhash = &hash
+
+	result := []store.MediaVariant{}
+
+	for _, v := range variants {
+		if !v.crop && max(width, height) <= v.size {
+			continue
+		}
+
+		resized := resize(img, v.size, v.crop)
+
+		out, err := encode(resized, format)
+		if err != nil {
+			return nil, err
+		}
+
+		key := base + "_" + v.name + out.ext
+
+		if err := p.put(ctx, key, out); err != nil {
+			return nil, err
+		}
+
+		result = append(result, store.MediaVariant{
+			Name:        v.name,
+			ContentType: out.contentType,
+			Size:        int64(len(out.data)),
+			Width:       resized.Bounds().Dx(),
+			Height:      resized.Bounds().Dy(),
+			StorageKey:  key,
+			URL:         p.blobs.URL(key),
+		})
+	}
+
+	return result, nil
+}
+
+func (p *Processor) put(ctx context.Context, key string, e encoded) error {
+	return p.blobs.Put(ctx, key, bytes.NewReader(e.data), int64(len(e.data)), e.contentType)
+}
+
+// encode writes PNGs as PNG and everything else as JPEG, unless it has
+// transparency to preserve. Variants of GIFs are stills of their first frame.
+func encode(img image.Image, format string) (encoded, error) {
+	var buf bytes.Buffer
+
+	if o, ok := img.(interface{ Opaque() bool }); format == "png" || format == "gif" || (ok && !o.Opaque()) {
+		if err := png.Encode(&buf, img); err != nil {
+			return encoded{}, err
+		}
+
+		return encoded{buf.Bytes(), "image/png", ".png"}, nil
+	}
+
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85}); err != nil {
+		return encoded{}, err
+	}
+
+	return encoded{buf.Bytes(), "image/jpeg", ".jpg"}, nil
+}
+
+// resize scales the image down so that its longest side is size. With crop,
+// the image is first cut down to the square in its centre.
+func resize(img image.Image, size int, crop bool) image.Image {
+	src := img.Bounds()
+
+	if crop {
+		side := min(src.Dx(), src.Dy())
+		x := src.Min.X + (src.Dx()-side)/2
+		y := src.Min.Y + (src.Dy()-side)/2
+		src = image.Rect(x, y, x+side, y+side)
+	}
+
+	width, height := src.Dx(), src.Dy()
+	if longest := max(width, height); longest > size {
+		width = max(1, width*size/longest)
+		height = max(1, height*size/longest)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, src, draw.Src, nil)
+
+	return dst
+}
@@ -0,0 +1,177 @@
+// Package images processes uploaded images in the background: it strips
+// their metadata, renders resized variants and records their dimensions and
+// blurhash placeholder.
+package images
+
+import (
+	"context"
+	"errors"
+	"log"
+	"social/social/internal/blob"
+	"social/social/internal/store"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	// Workers is the number of images processed concurrently.
+	Workers   int
+	QueueSize int
+	// MaxAttempts is the number of times an image is tried before it is
+	// marked as failed. Attempts are spaced out by RetryBackoff, doubled
+	// after each failure.
+	MaxAttempts  int
+	RetryBackoff time.Duration
+	// SweepInterval is how often the database is checked for images that are
+	// due for processing, such as retries and uploads that did not fit in
+	// the queue.
+	SweepInterval time.Duration
+	// StaleAfter bounds the time spent on an image. Images claimed for longer
+	// are considered abandoned and picked up again.
+	StaleAfter time.Duration
+}
+
+// Processor is an in-process worker pool. The state of every image is kept
+// in the database, so images survive restarts and can be processed by any
+// API instance.
+type Processor struct {
+	store store.Storage
+	blobs blob.BlobStore
+	cfg   Config
+	queue chan int64
+}
+
+func NewProcessor(store store.Storage, blobs blob.BlobStore, cfg Config) *Processor {
+	return &Processor{
+		store: store,
+		blobs: blobs,
+		cfg:   cfg,
+		queue: make(chan int64, cfg.QueueSize),
+	}
+}
+
+// Enqueue schedules the image for processing. It never blocks: when the queue
+// is full the image is left for the next sweep.
+func (p *Processor) Enqueue(mediaID int64) {
+	select {
+	case p.queue <- mediaID:
+	default:
+	}
+}
+
+// Run starts the workers and sweeps the database until ctx is cancelled.
+func (p *Processor) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	for range p.cfg.Workers {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			p.work(ctx)
+		}()
+	}
+
+	ticker := time.NewTicker(p.cfg.SweepInterval)
+	defer ticker.Stop()
+
+	for {
+		p.sweep(ctx)
+
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Processor) sweep(ctx context.Context) {
+	ids, err := p.store.Media.GetProcessable(ctx, p.cfg.StaleAfter, p.cfg.QueueSize)
+	if err != nil {
+		log.Printf("error looking up images to process: %s", err)
+		return
+	}
+
+	for _, id := range ids {
+		select {
+		case p.queue <- id:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (p *Processor) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-p.queue:
+			p.handle(ctx, id)
+		}
+	}
+}
+
+func (p *Processor) handle(ctx context.Context, id int64) {
+	// The same image may be queued more than once; only one claim succeeds.
+	media, err := p.store.Media.ClaimForProcessing(ctx, id, p.cfg.StaleAfter)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			log.Printf("error claiming image %d: %s", id, err)
+		}
+
+		return
+	}
+
+	runCtx := ctx
+
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.StaleAfter)
+	defer cancel()
+
+	uploadKey := media.StorageKey
+
+	variants, err := p.process(ctx, media)
+	if err == nil {
+		err = p.store.Media.CompleteProcessing(ctx, media, variants)
+	}
+
+	if err != nil {
+		// Work interrupted by a shutdown does not count as a failure: the
+		// claim goes stale and the image is picked up again.
+		if runCtx.Err() != nil {
+			return
+		}
+
+		log.Printf("error processing image %d (attempt %d): %s", id, media.Attempts, err)
+
+		var retryAt *time.Time
+		if media.Attempts < p.cfg.MaxAttempts && !errors.Is(err, ErrUnsupported) {
+			t := time.Now().Add(p.cfg.RetryBackoff << (media.Attempts - 1))
+			retryAt = &t
+		}
+
+		if err := p.store.Media.FailProcessing(context.WithoutCancel(ctx), id, retryAt); err != nil {
+			log.Printf("error releasing image %d: %s", id, err)
+			return
+		}
+
+		// An image that failed for good is never served, so its upload
+		// would only keep the original metadata around.
+		if retryAt == nil {
+			if err := p.blobs.Delete(context.WithoutCancel(ctx), uploadKey); err != nil {
+				log.Printf("error deleting upload of image %d: %s", id, err)
+			}
+		}
+
+		return
+	}
+
+	// The upload still carries the original metadata.
+	if uploadKey != media.StorageKey {
+		if err := p.blobs.Delete(ctx, uploadKey); err != nil {
+			log.Printf("error deleting upload of image %d: %s", id, err)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"text/template"
+	"time"
+)
+
+// FileMailer renders emails and writes them to a directory instead of
+// delivering them. It is meant for local development.
+type FileMailer struct {
+	fromEmail string
+	dir       string
+}
+
+func NewFileMailer(fromEmail, dir string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &FileMailer{fromEmail, dir}, nil
+}
+
+func (m *FileMailer) Send(templateFile, username, email string, data any) error {
+	tmpl, err := template.ParseFS(FS, "templates/"+templateFile)
+	if err != nil {
+		return err
+	}
+
+	subject := new(bytes.Buffer)
+	if err := tmpl.ExecuteTemplate(subject, "subject", data); err != nil {
+		return err
+	}
+
+	body := new(bytes.Buffer)
+	if err := tmpl.ExecuteTemplate(body, "body", data); err != nil {
+		return err
+	}
+
+	msg := new(bytes.Buffer)
+	fmt.Fprintf(msg, "From: %s <%s>\r\n", FromName, m.fromEmail)
+	fmt.Fprintf(msg, "To: %s <%s>\r\n", username, email)
+	fmt.Fprintf(msg, "Subject: %s\r\n", subject.String())
+	fmt.Fprintf(msg, "Content-Type: text/html; charset=UTF-8\r\n\r\n")
+	msg.Write(body.Bytes())
+
+	filename := fmt.Sprintf("%d_%s.eml", time.Now().UnixNano(), email)
+	path := filepath.Join(m.dir, filename)
+
+	if err := os.WriteFile(path, msg.Bytes(), 0o644); err != nil {
+		return err
+	}
+
+	log.Printf("Email to %s written to %s", email, path)
+
+	return nil
+}
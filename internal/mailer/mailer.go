@@ -0,0 +1,16 @@
+package mailer
+
+import "embed"
+
+const (
+	FromName               = "GoSocial"
+	UserInvitationTemplate = "user_invitation.tmpl"
+	EmailChangeTemplate    = "email_change.tmpl"
+)
+
+//go:embed "templates"
+var FS embed.FS
+
+type Client interface {
+	Send(templateFile, username, email string, data any) error
+}
@@ -0,0 +1,143 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+var ErrBlocked = errors.New("one of the users has blocked the other")
+
+type BlockStore struct {
+	db       *sql.DB
+	timeline *TimelineStore
+}
+
+// Block stops userID from interacting with blockedID: follows and pending
+// follow requests are removed both ways and new ones are refused.
+func (s *BlockStore) Block(ctx context.Context, userID, blockedID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := lockPair(ctx, tx, userID, blockedID); err != nil {
+			return err
+		}
+
+		query := `
+			INSERT INTO user_blocks (blocker_id, blocked_id) VALUES ($1, $2)
+			ON CONFLICT DO NOTHING;
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		if _, err := tx.ExecContext(ctx, query, userID, blockedID); err != nil {
+			return err
+		}
+
+		query = `
+			WITH requests AS (
+				DELETE FROM follow_requests
+				WHERE (user_id = $1 AND requester_id = $2) OR (user_id = $2 AND requester_id = $1)
+			)
+			DELETE FROM followers
+			WHERE (user_id = $1 AND follower_id = $2) OR (user_id = $2 AND follower_id = $1);
+		`
+
+		if _, err := tx.ExecContext(ctx, query, userID, blockedID); err != nil {
+			return err
+		}
+
+		if s.timeline == nil {
+			return nil
+		}
+
+		if err := s.timeline.removeAuthor(ctx, tx, userID, blockedID); err != nil {
+			return err
+		}
+
+		return s.timeline.removeAuthor(ctx, tx, blockedID, userID)
+	})
+}
+
+func (s *BlockStore) Unblock(ctx context.Context, userID, blockedID int64) error {
+	query := `
+		DELETE FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID, blockedID)
+	return err
+}
+
+// Mute hides mutedID's posts from userID's feed without them knowing.
+func (s *BlockStore) Mute(ctx context.Context, userID, mutedID int64) error {
+	query := `
+		INSERT INTO user_mutes (muter_id, muted_id) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID, mutedID)
+	return err
+}
+
+func (s *BlockStore) Unmute(ctx context.Context, userID, mutedID int64) error {
+	query := `
+		DELETE FROM user_mutes WHERE muter_id = $1 AND muted_id = $2;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID, mutedID)
+	return err
+}
+
+// isBlocked reports whether either user has blocked the other.
+func isBlocked(ctx context.Context, q querier, a, b int64) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM user_blocks
+			WHERE (blocker_id = $1 AND blocked_id = $2) OR (blocker_id = $2 AND blocked_id = $1)
+		);
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var blocked bool
+	err := q.QueryRowContext(ctx, query, a, b).Scan(&blocked)
+
+	return blocked, err
+}
+
+// lockPair serializes the transactions changing the relationship between
+// two users, such as a follow racing a block, until tx ends. Without it, a
+// statement could miss a row committed by the other transaction in the
+// meantime.
+func lockPair(ctx context.Context, tx *sql.Tx, a, b int64) error {
+	query := `
+		SELECT pg_advisory_xact_lock(hashtextextended(
+			'users:' || LEAST($1::bigint, $2::bigint) || ':' || GREATEST($1::bigint, $2::bigint), 0
+		));
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, a, b)
+	return err
+}
+
+// notBlockedClause excludes rows whose author column has a block in either
+// direction with the viewer bound to the given placeholder.
+func notBlockedClause(author, viewer string) string {
+	return `NOT EXISTS (
+		SELECT 1 FROM user_blocks ub
+		WHERE (ub.blocker_id = ` + viewer + ` AND ub.blocked_id = ` + author + `)
+			OR (ub.blocker_id = ` + author + ` AND ub.blocked_id = ` + viewer + `)
+	)`
+}
@@ -0,0 +1,236 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// Collection is a named, private list of posts saved by a user.
+type Collection struct {
+	ID        int64  `json:"id"`
+	UserID    int64  `json:"user_id"`
+	Name      string `json:"name"`
+	CreatedAt string `json:"created_at"`
+}
+
+type SavedPost struct {
+	PostWithMetaData
+	SavedAt string `json:"saved_at"`
+}
+
+type CollectionStore struct {
+	db *sql.DB
+}
+
+func (s *CollectionStore) Create(ctx context.Context, collection *Collection) error {
+	query := `
+		INSERT INTO collections (user_id, name) VALUES ($1, $2) RETURNING id, created_at;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		collection.UserID,
+		collection.Name,
+	).Scan(
+		&collection.ID,
+		&collection.CreatedAt,
+	)
+
+	if err != nil {
+		if pqError, ok := err.(*pq.Error); ok && pqError.Code == "23505" {
+			return ErrConflict
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (s *CollectionStore) GetByID(ctx context.Context, collectionID int64) (*Collection, error) {
+	query := `
+		SELECT id, user_id, name, created_at FROM collections WHERE id = $1;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	collection := new(Collection)
+
+	err := s.db.QueryRowContext(ctx, query, collectionID).Scan(
+		&collection.ID,
+		&collection.UserID,
+		&collection.Name,
+		&collection.CreatedAt,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return collection, nil
+}
+
+func (s *CollectionStore) GetByUserID(ctx context.Context, userID int64) ([]Collection, error) {
+	query := `
+		SELECT id, user_id, name, created_at FROM collections
+		WHERE user_id = $1
+		ORDER BY name;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	collections := []Collection{}
+
+	for rows.Next() {
+		var c Collection
+
+		if err := rows.Scan(&c.ID, &c.UserID, &c.Name, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		collections = append(collections, c)
+	}
+
+	return collections, rows.Err()
+}
+
+func (s *CollectionStore) Delete(ctx context.Context, collectionID int64) error {
+	query := `
+		DELETE FROM collections WHERE id = $1;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, collectionID)
+	return err
+}
+
+// AddPost saves a post into a collection. Saving it twice is a no-op.
+func (s *CollectionStore) AddPost(ctx context.Context, collectionID, postID int64) error {
+	query := `
+		INSERT INTO collection_posts (collection_id, post_id) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, collectionID, postID)
+	return err
+}
+
+func (s *CollectionStore) RemovePost(ctx context.Context, collectionID, postID int64) error {
+	query := `
+		DELETE FROM collection_posts WHERE collection_id = $1 AND post_id = $2;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, collectionID, postID)
+	return err
+}
+
+// GetPosts returns a page of a collection's posts, most recently saved
+// first. Posts the viewer is no longer allowed to see are skipped.
+func (s *CollectionStore) GetPosts(ctx context.Context, collectionID, viewerID int64, q PaginatedQuery) ([]SavedPost, error) {
+	query := `
+		SELECT
+			p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags, p.quoted_post_id,
+			u.username,
+			(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id) AS comments_count,
+			` + reactionCountsColumn("p.id") + ` AS reactions,
+			` + viewerReactionColumn("p.id", "$5") + ` AS viewer_reaction,
+			` + repostsCountColumn("p.id") + ` AS reposts_count,
+			cp.created_at
+		FROM collection_posts cp
+		JOIN posts p ON p.id = cp.post_id
+		JOIN users u ON p.user_id = u.id
+		WHERE
+			cp.collection_id = $1 AND
+			` + visibleToViewerClause("$5") + ` AND
+			($2::timestamptz IS NULL OR (cp.created_at, p.id) < ($2, $3))
+		ORDER BY cp.created_at DESC, p.id DESC
+		LIMIT $4;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	cursorCreatedAt, cursorID := q.Cursor.cursorArgs()
+
+	rows, err := s.db.QueryContext(ctx, query, collectionID, cursorCreatedAt, cursorID, q.Limit, viewerID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	posts := []SavedPost{}
+
+	for rows.Next() {
+		var post SavedPost
+		var viewerReaction sql.NullString
+
+		err := rows.Scan(
+			&post.ID,
+			&post.UserID,
+			&post.Title,
+			&post.Content,
+			&post.CreatedAt,
+			&post.Version,
+			pq.Array(&post.Tags),
+			&post.QuotedPostID,
+			&post.User.Username,
+			&post.CommentCount,
+			&post.Reactions,
+			&viewerReaction,
+			&post.RepostsCount,
+			&post.SavedAt,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if viewerReaction.Valid {
+			post.ViewerReaction = &viewerReaction.String
+		}
+
+		posts = append(posts, post)
+	}
+
+	return posts, rows.Err()
+}
+
+// deleteSavedPost removes a post from every collection it was saved in.
+func deleteSavedPost(ctx context.Context, q querier, postID int64) error {
+	query := `
+		DELETE FROM collection_posts WHERE post_id = $1;
+	`
+
+	_, err := q.ExecContext(ctx, query, postID)
+	return err
+}
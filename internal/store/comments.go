@@ -3,53 +3,174 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
 )
 
 type Comment struct {
-	ID        int64  `json:"id"`
-	PostID    int64  `json:"post_id"`
-	UserID    int64  `json:"user_id"`
-	Content   string `json:"content"`
-	CreatedAt string `json:"created_at"`
-	User      User   `json:"user"`
+	ID         int64     `json:"id"`
+	PostID     int64     `json:"post_id"`
+	UserID     int64     `json:"user_id"`
+	ParentID   *int64    `json:"parent_id"`
+	Content    string    `json:"content"`
+	CreatedAt  string    `json:"created_at"`
+	User       User      `json:"user"`
+	Depth      int       `json:"depth"`
+	ReplyCount int       `json:"reply_count"`
+	Replies    []Comment `json:"replies,omitempty"`
 }
 
 type CommentStore struct {
 	db *sql.DB
 }
 
+// Create inserts the comment and notifies the author of the post, or the
+// author of the parent comment for replies. A post author replied to on their
+// own post is only notified of the reply.
 func (s *CommentStore) Create(ctx context.Context, comment *Comment) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			INSERT INTO comments (post_id, user_id, parent_id, content)
+			VALUES ($1, $2, $3, $4) RETURNING id, created_at;
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		err := tx.QueryRowContext(
+			ctx,
+			query,
+			comment.PostID,
+			comment.UserID,
+			comment.ParentID,
+			comment.Content,
+		).Scan(
+			&comment.ID,
+			&comment.CreatedAt,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		postAuthor := `(
+			SELECT p.user_id FROM comments c
+			JOIN posts p ON p.id = c.post_id
+			LEFT JOIN comments pc ON pc.id = c.parent_id
+			WHERE c.id = $1 AND p.user_id IS DISTINCT FROM pc.user_id
+		)`
+
+		if err := notify(ctx, tx, NotificationComment, postAuthor, comment.ID, comment.UserID, &comment.PostID, &comment.ID); err != nil {
+			return err
+		}
+
+		if comment.ParentID == nil {
+			return nil
+		}
+
+		parentAuthor := `(SELECT user_id FROM comments WHERE id = $1)`
+
+		return notify(ctx, tx, NotificationReply, parentAuthor, *comment.ParentID, comment.UserID, &comment.PostID, &comment.ID)
+	})
+}
+
+func (s *CommentStore) GetByID(ctx context.Context, commentID int64) (*Comment, error) {
 	query := `
-		INSERT INTO comments (post_id, user_id, content)
-		VALUES ($1, $2, $3) RETURNING id, created_at;
+		SELECT c.id, c.post_id, c.user_id, c.parent_id, c.content, c.created_at, users.username, users.id,
+			(SELECT COUNT(*) FROM comments r WHERE r.parent_id = c.id) AS reply_count
+		FROM comments c
+		JOIN users ON users.id = c.user_id
+		WHERE c.id = $1;
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	err := s.db.QueryRowContext(
-		ctx,
-		query,
-		comment.PostID,
-		comment.UserID,
-		comment.Content,
-	).Scan(
-		&comment.ID,
-		&comment.CreatedAt,
+	c := new(Comment)
+	var parentID sql.NullInt64
+
+	err := s.db.QueryRowContext(ctx, query, commentID).Scan(
+		&c.ID,
+		&c.PostID,
+		&c.UserID,
+		&parentID,
+		&c.Content,
+		&c.CreatedAt,
+		&c.User.Username,
+		&c.User.ID,
+		&c.ReplyCount,
 	)
 
-	return err
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if parentID.Valid {
+		c.ParentID = &parentID.Int64
+	}
+
+	return c, nil
+}
+
+// GetByPostId returns a page of a post's top-level comments, newest first,
+// with their replies nested up to q.Depth levels below them. Only comments
+// older than q.Cursor are returned when it is set. Comments by users who
+// blocked, or were blocked by, the viewer are left out along with their
+// replies.
+func (s *CommentStore) GetByPostId(ctx context.Context, postID, viewerID int64, q PaginatedCommentsQuery) ([]Comment, error) {
+	return s.getThread(ctx, postID, nil, viewerID, q)
 }
 
-func (s *CommentStore) GetByPostId(ctx context.Context, postID int64) ([]Comment, error) {
+// GetReplies is like GetByPostId but pages through the direct replies of a
+// comment, which lets clients lazily expand threads using ReplyCount.
+func (s *CommentStore) GetReplies(ctx context.Context, parent *Comment, viewerID int64, q PaginatedCommentsQuery) ([]Comment, error) {
+	return s.getThread(ctx, parent.PostID, &parent.ID, viewerID, q)
+}
+
+func (s *CommentStore) getThread(ctx context.Context, postID int64, parentID *int64, viewerID int64, q PaginatedCommentsQuery) ([]Comment, error) {
 	query := `
-		SELECT c.id, c.post_id, c.content, c.created_at, users.username, users.id FROM comments c
+		WITH RECURSIVE roots AS (
+			SELECT c.id FROM comments c
+			WHERE c.post_id = $1
+				AND c.parent_id IS NOT DISTINCT FROM $2
+				AND ($3::timestamptz IS NULL OR (c.created_at, c.id) < ($3, $4))
+				AND ` + notBlockedClause("c.user_id", "$7") + `
+			ORDER BY c.created_at DESC, c.id DESC
+			LIMIT $5
+		), thread AS (
+			SELECT id, 0 AS depth FROM roots
+			UNION ALL
+			SELECT c.id, t.depth + 1 FROM comments c
+			JOIN thread t ON c.parent_id = t.id
+			WHERE t.depth < $6
+				AND ` + notBlockedClause("c.user_id", "$7") + `
+		)
+		SELECT c.id, c.post_id, c.user_id, c.parent_id, c.content, c.created_at, users.username, users.id,
+			t.depth,
+			(
+				SELECT COUNT(*) FROM comments r
+				WHERE r.parent_id = c.id AND ` + notBlockedClause("r.user_id", "$7") + `
+			) AS reply_count
+		FROM thread t
+		JOIN comments c ON c.id = t.id
 		JOIN users ON users.id = c.user_id
-		WHERE c.post_id = $1
-		ORDER BY c.created_at DESC;
+		ORDER BY
+			t.depth,
+			CASE WHEN t.depth = 0 THEN c.created_at END DESC,
+			CASE WHEN t.depth = 0 THEN c.id END DESC,
+			c.created_at, c.id;
 	`
 
-	rows, err := s.db.QueryContext(ctx, query, postID)
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	cursorCreatedAt, cursorID := q.Cursor.cursorArgs()
+
+	rows, err := s.db.QueryContext(ctx, query, postID, parentID, cursorCreatedAt, cursorID, q.Limit, q.Depth, viewerID)
 
 	if err != nil {
 		return nil, err
@@ -61,16 +182,116 @@ func (s *CommentStore) GetByPostId(ctx context.Context, postID int64) ([]Comment
 
 	for rows.Next() {
 		var c Comment
+		var parent sql.NullInt64
 
 		c.User = User{}
-		err := rows.Scan(&c.ID, &c.PostID, &c.Content, &c.CreatedAt, &c.User.Username, &c.User.ID)
+		err := rows.Scan(
+			&c.ID,
+			&c.PostID,
+			&c.UserID,
+			&parent,
+			&c.Content,
+			&c.CreatedAt,
+			&c.User.Username,
+			&c.User.ID,
+			&c.Depth,
+			&c.ReplyCount,
+		)
 
 		if err != nil {
 			return nil, err
 		}
 
+		if parent.Valid {
+			c.ParentID = &parent.Int64
+		}
+
 		comments = append(comments, c)
 	}
 
-	return comments, nil
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return buildCommentTree(comments), nil
+}
+
+// buildCommentTree nests comments ordered by depth under their parents. The
+// depth 0 comments are returned in their original order.
+func buildCommentTree(flat []Comment) []Comment {
+	children := make(map[int64][]Comment)
+	roots := []Comment{}
+
+	for _, c := range flat {
+		if c.Depth == 0 {
+			roots = append(roots, c)
+			continue
+		}
+
+		children[*c.ParentID] = append(children[*c.ParentID], c)
+	}
+
+	var attach func(c *Comment)
+	attach = func(c *Comment) {
+		c.Replies = children[c.ID]
+		for i := range c.Replies {
+			attach(&c.Replies[i])
+		}
+	}
+
+	for i := range roots {
+		attach(&roots[i])
+	}
+
+	return roots
+}
+
+func (s *CommentStore) Update(ctx context.Context, comment *Comment) error {
+	query := `
+		UPDATE comments SET content = $1 WHERE id = $2;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, comment.Content, comment.ID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *CommentStore) Delete(ctx context.Context, commentID int64) error {
+	query := `
+		DELETE FROM comments WHERE id = $1;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, commentID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
 }
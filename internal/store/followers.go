@@ -13,36 +13,360 @@ type Follower struct {
 	CreatedAt  string `json:"created_at"`
 }
 
+// FollowEntry is a user appearing in a follower or following listing.
+// IsFollowing tells whether the viewer follows that user.
+type FollowEntry struct {
+	User        User   `json:"user"`
+	FollowedAt  string `json:"followed_at"`
+	IsFollowing bool   `json:"is_following"`
+}
+
+// FollowRequest is a pending request to follow a private account.
+type FollowRequest struct {
+	User        User   `json:"user"`
+	RequestedAt string `json:"requested_at"`
+}
+
 type FollowerStore struct {
-	db *sql.DB
+	db       *sql.DB
+	timeline *TimelineStore
 }
 
+// Follow makes followerID follow userID and notifies userID about it.
 func (s *FollowerStore) Follow(ctx context.Context, followerID, userID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := s.follow(ctx, tx, followerID, userID); err != nil {
+			return err
+		}
+
+		if err := notify(ctx, tx, NotificationFollow, "$1::bigint", userID, followerID, nil, nil); err != nil {
+			return err
+		}
+
+		if s.timeline == nil {
+			return nil
+		}
+
+		return s.timeline.backfillAuthor(ctx, tx, followerID, userID)
+	})
+}
+
+func (s *FollowerStore) follow(ctx context.Context, tx *sql.Tx, followerID, userID int64) error {
+	if err := lockPair(ctx, tx, followerID, userID); err != nil {
+		return err
+	}
+
+	// The block check is part of the insert, so that the follow cannot be
+	// recorded once a block is.
 	query := `
-		INSERT INTO followers (user_id, follower_id) VALUES ($1, $2);
+		INSERT INTO followers (user_id, follower_id)
+		SELECT $1, $2
+		WHERE ` + notBlockedClause("$1::bigint", "$2::bigint") + `;
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	_, err := s.db.ExecContext(ctx, query, userID, followerID)
+	res, err := tx.ExecContext(ctx, query, userID, followerID)
 	if err != nil {
 		if pqError, ok := err.(*pq.Error); ok && pqError.Code == "23505" {
 			return ErrConflict
 		}
+
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrBlocked
 	}
 
 	return nil
 }
 
+// RequestFollow records a pending request from followerID to follow the
+// private account userID and notifies userID about it. It returns
+// ErrConflict when a request is already pending or the follow already
+// exists, and ErrBlocked when either user has blocked the other.
+func (s *FollowerStore) RequestFollow(ctx context.Context, followerID, userID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := lockPair(ctx, tx, followerID, userID); err != nil {
+			return err
+		}
+
+		query := `
+			INSERT INTO follow_requests (user_id, requester_id)
+			SELECT $1, $2
+			WHERE
+				NOT EXISTS (SELECT 1 FROM followers WHERE user_id = $1 AND follower_id = $2) AND
+				` + notBlockedClause("$1::bigint", "$2::bigint") + `;
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		res, err := tx.ExecContext(ctx, query, userID, followerID)
+		if err != nil {
+			if pqError, ok := err.(*pq.Error); ok && pqError.Code == "23505" {
+				return ErrConflict
+			}
+
+			return err
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rows == 0 {
+			blocked, err := isBlocked(ctx, tx, followerID, userID)
+			if err != nil {
+				return err
+			}
+
+			if blocked {
+				return ErrBlocked
+			}
+
+			return ErrConflict
+		}
+
+		return notify(ctx, tx, NotificationFollowRequest, "$1::bigint", userID, followerID, nil, nil)
+	})
+}
+
+// AcceptRequest turns a pending follow request into a follow.
+func (s *FollowerStore) AcceptRequest(ctx context.Context, userID, requesterID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := s.deleteRequest(ctx, tx, userID, requesterID); err != nil {
+			return err
+		}
+
+		if err := s.follow(ctx, tx, requesterID, userID); err != nil {
+			return err
+		}
+
+		if s.timeline == nil {
+			return nil
+		}
+
+		return s.timeline.backfillAuthor(ctx, tx, requesterID, userID)
+	})
+}
+
+func (s *FollowerStore) RejectRequest(ctx context.Context, userID, requesterID int64) error {
+	return s.deleteRequest(ctx, s.db, userID, requesterID)
+}
+
+func (s *FollowerStore) deleteRequest(ctx context.Context, q querier, userID, requesterID int64) error {
+	query := `
+		DELETE FROM follow_requests WHERE user_id = $1 AND requester_id = $2;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := q.ExecContext(ctx, query, userID, requesterID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// GetFollowRequests returns a page of the requests pending on userID, most
+// recent first.
+func (s *FollowerStore) GetFollowRequests(ctx context.Context, userID int64, q PaginatedQuery) ([]FollowRequest, error) {
+	query := `
+		SELECT u.id, u.username, u.created_at, fr.created_at
+		FROM follow_requests fr
+		JOIN users u ON u.id = fr.requester_id
+		WHERE fr.user_id = $1
+			AND ($2::timestamptz IS NULL OR (fr.created_at, u.id) < ($2, $3))
+		ORDER BY fr.created_at DESC, u.id DESC
+		LIMIT $4;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	cursorCreatedAt, cursorID := q.Cursor.cursorArgs()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, cursorCreatedAt, cursorID, q.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	requests := []FollowRequest{}
+
+	for rows.Next() {
+		var fr FollowRequest
+
+		err := rows.Scan(
+			&fr.User.ID,
+			&fr.User.Username,
+			&fr.User.CreatedAt,
+			&fr.RequestedAt,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		requests = append(requests, fr)
+	}
+
+	return requests, rows.Err()
+}
+
 func (s *FollowerStore) Unfollow(ctx context.Context, followerID, userID int64) error {
+	if s.timeline == nil {
+		return s.unfollow(ctx, s.db, followerID, userID)
+	}
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := s.unfollow(ctx, tx, followerID, userID); err != nil {
+			return err
+		}
+
+		return s.timeline.removeAuthor(ctx, tx, followerID, userID)
+	})
+}
+
+// unfollow removes the follow along with any request still pending on a
+// private account, which lets requesters cancel them.
+func (s *FollowerStore) unfollow(ctx context.Context, q querier, followerID, userID int64) error {
 	query := `
+		WITH pending AS (
+			DELETE FROM follow_requests WHERE user_id = $1 AND requester_id = $2
+		)
 		DELETE FROM followers WHERE user_id = $1 AND follower_id = $2;
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	_, err := s.db.ExecContext(ctx, query, userID, followerID)
+	_, err := q.ExecContext(ctx, query, userID, followerID)
 	return err
 }
+
+// GetFollowers returns a page of the users following userID, most recent
+// follows first.
+func (s *FollowerStore) GetFollowers(ctx context.Context, userID, viewerID int64, q PaginatedQuery) ([]FollowEntry, error) {
+	query := `
+		SELECT u.id, u.username, u.created_at, f.created_at,
+			EXISTS (SELECT 1 FROM followers vf WHERE vf.user_id = u.id AND vf.follower_id = $2)
+		FROM followers f
+		JOIN users u ON u.id = f.follower_id
+		WHERE f.user_id = $1
+			AND ($3::timestamptz IS NULL OR (f.created_at, u.id) < ($3, $4))
+		ORDER BY f.created_at DESC, u.id DESC
+		LIMIT $5;
+	`
+
+	return s.list(ctx, query, userID, viewerID, q)
+}
+
+// GetFollowing returns a page of the users that userID follows, most recent
+// follows first.
+func (s *FollowerStore) GetFollowing(ctx context.Context, userID, viewerID int64, q PaginatedQuery) ([]FollowEntry, error) {
+	query := `
+		SELECT u.id, u.username, u.created_at, f.created_at,
+			EXISTS (SELECT 1 FROM followers vf WHERE vf.user_id = u.id AND vf.follower_id = $2)
+		FROM followers f
+		JOIN users u ON u.id = f.user_id
+		WHERE f.follower_id = $1
+			AND ($3::timestamptz IS NULL OR (f.created_at, u.id) < ($3, $4))
+		ORDER BY f.created_at DESC, u.id DESC
+		LIMIT $5;
+	`
+
+	return s.list(ctx, query, userID, viewerID, q)
+}
+
+func (s *FollowerStore) list(ctx context.Context, query string, userID, viewerID int64, q PaginatedQuery) ([]FollowEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	cursorCreatedAt, cursorID := q.Cursor.cursorArgs()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, viewerID, cursorCreatedAt, cursorID, q.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	entries := []FollowEntry{}
+
+	for rows.Next() {
+		var e FollowEntry
+
+		err := rows.Scan(
+			&e.User.ID,
+			&e.User.Username,
+			&e.User.CreatedAt,
+			&e.FollowedAt,
+			&e.IsFollowing,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+// GetFeedAuthorIDs returns the ids of the users whose new posts belong in
+// userID's feed: themselves and the accounts they follow and have not muted.
+func (s *FollowerStore) GetFeedAuthorIDs(ctx context.Context, userID int64) ([]int64, error) {
+	query := `
+		SELECT $1::bigint
+		UNION
+		SELECT f.user_id FROM followers f
+		WHERE f.follower_id = $1
+			AND NOT EXISTS (SELECT 1 FROM user_mutes m WHERE m.muter_id = $1 AND m.muted_id = f.user_id);
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var ids []int64
+
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
@@ -0,0 +1,36 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestFollowRefusedAfterBlock(t *testing.T) {
+	s, _ := newTestStorage(t)
+	ctx := context.Background()
+
+	user := createTestUser(t, s, "block_target")
+	follower := createTestUser(t, s, "block_follower")
+	requester := createTestUser(t, s, "block_requester")
+
+	if err := s.Followers.RequestFollow(ctx, requester.ID, user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Blocks.Block(ctx, user.ID, follower.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Followers.Follow(ctx, follower.ID, user.ID); !errors.Is(err, ErrBlocked) {
+		t.Errorf("Follow: err = %v, want ErrBlocked", err)
+	}
+
+	if err := s.Followers.RequestFollow(ctx, follower.ID, user.ID); !errors.Is(err, ErrBlocked) {
+		t.Errorf("RequestFollow: err = %v, want ErrBlocked", err)
+	}
+
+	if err := s.Followers.RequestFollow(ctx, requester.ID, user.ID); !errors.Is(err, ErrConflict) {
+		t.Errorf("RequestFollow twice: err = %v, want ErrConflict", err)
+	}
+}
@@ -0,0 +1,431 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var ErrInvalidAttachment = errors.New("attachment does not exist or is already in use")
+
+const (
+	MediaPending    = "pending"
+	MediaProcessing = "processing"
+	MediaReady      = "ready"
+	MediaFailed     = "failed"
+)
+
+// Media is an uploaded image or video. It belongs to its uploader until it
+// is attached to one of their posts. Images are not served, and have no URL,
+// until they are processed.
+type Media struct {
+	ID          int64          `json:"id"`
+	UserID      int64          `json:"user_id"`
+	PostID      *int64         `json:"post_id"`
+	Kind        string         `json:"kind"`
+	ContentType string         `json:"content_type"`
+	Size        int64          `json:"size"`
+	StorageKey  string         `json:"-"`
+	URL         *string        `json:"url"`
+	Status      string         `json:"status"`
+	Width       *int           `json:"width"`
+	Height      *int           `json:"height"`
+	Blurhash    *string        `json:"blurhash"`
+	Variants    []MediaVariant `json:"variants"`
+	Attempts    int            `json:"-"`
+	CreatedAt   string         `json:"created_at"`
+}
+
+// MediaVariant is a resized copy of an image, such as its thumbnail.
+type MediaVariant struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	StorageKey  string `json:"-"`
+	URL         string `json:"url"`
+}
+
+const mediaColumns = `
+	id, user_id, post_id, kind, content_type, size_bytes, storage_key, url,
+	status, width, height, blurhash, attempts, created_at`
+
+func scanMedia(row rowScanner, m *Media, extra ...any) error {
+	return row.Scan(append([]any{
+		&m.ID,
+		&m.UserID,
+		&m.PostID,
+		&m.Kind,
+		&m.ContentType,
+		&m.Size,
+		&m.StorageKey,
+		&m.URL,
+		&m.Status,
+		&m.Width,
+		&m.Height,
+		&m.Blurhash,
+		&m.Attempts,
+		&m.CreatedAt,
+	}, extra...)...)
+}
+
+type MediaStore struct {
+	db *sql.DB
+}
+
+func (s *MediaStore) Create(ctx context.Context, media *Media) error {
+	query := `
+		INSERT INTO media (user_id, kind, content_type, size_bytes, storage_key, url, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	media.Variants = []MediaVariant{}
+
+	return s.db.QueryRowContext(
+		ctx,
+		query,
+		media.UserID,
+		media.Kind,
+		media.ContentType,
+		media.Size,
+		media.StorageKey,
+		media.URL,
+		media.Status,
+	).Scan(
+		&media.ID,
+		&media.CreatedAt,
+	)
+}
+
+// GetByPostID returns the attachments of a post in the order they were
+// attached.
+func (s *MediaStore) GetByPostID(ctx context.Context, postID int64) ([]Media, error) {
+	media, err := s.GetByPostIDs(ctx, []int64{postID})
+	if err != nil {
+		return nil, err
+	}
+
+	if media[postID] == nil {
+		return []Media{}, nil
+	}
+
+	return media[postID], nil
+}
+
+// GetByPostIDs returns the attachments of several posts at once, keyed by
+// post. Posts without attachments are left out.
+func (s *MediaStore) GetByPostIDs(ctx context.Context, postIDs []int64) (map[int64][]Media, error) {
+	query := `
+		SELECT ` + mediaColumns + `
+		FROM media
+		WHERE post_id = ANY($1)
+		ORDER BY post_id, position, id;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(postIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	media := []Media{}
+
+	for rows.Next() {
+		var m Media
+		if err := scanMedia(rows, &m); err != nil {
+			return nil, err
+		}
+
+		media = append(media, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := loadVariants(ctx, s.db, media); err != nil {
+		return nil, err
+	}
+
+	byPost := map[int64][]Media{}
+	for _, m := range media {
+		byPost[*m.PostID] = append(byPost[*m.PostID], m)
+	}
+
+	return byPost, nil
+}
+
+// GetProcessable returns the images that are due for processing: the pending
+// ones and the ones whose processing was claimed more than staleAfter ago,
+// most likely by a worker that did not survive it.
+func (s *MediaStore) GetProcessable(ctx context.Context, staleAfter time.Duration, limit int) ([]int64, error) {
+	query := `
+		SELECT id FROM media
+		WHERE kind = 'image' AND (
+			(status = 'pending' AND next_attempt_at <= NOW()) OR
+			(status = 'processing' AND claimed_at < NOW() - make_interval(secs => $1))
+		)
+		ORDER BY next_attempt_at, id
+		LIMIT $2;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, staleAfter.Seconds(), limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	ids := []int64{}
+
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// ClaimForProcessing marks the image as being processed and counts the
+// attempt. It returns ErrNotFound when the image is not due for processing,
+// e.g. because another worker claimed it first.
+func (s *MediaStore) ClaimForProcessing(ctx context.Context, id int64, staleAfter time.Duration) (*Media, error) {
+	query := `
+		UPDATE media SET status = 'processing', claimed_at = NOW(), attempts = attempts + 1
+		WHERE id = $1 AND kind = 'image' AND (
+			(status = 'pending' AND next_attempt_at <= NOW()) OR
+			(status = 'processing' AND claimed_at < NOW() - make_interval(secs => $2))
+		)
+		RETURNING ` + mediaColumns + `;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var media Media
+
+	err := scanMedia(s.db.QueryRowContext(ctx, query, id, staleAfter.Seconds()), &media)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &media, nil
+}
+
+// CompleteProcessing stores the variants of a processed image along with the
+// fields the processing filled in, and makes the image available.
+func (s *MediaStore) CompleteProcessing(ctx context.Context, media *Media, variants []MediaVariant) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		query := `
+			UPDATE media
+			SET status = 'ready', claimed_at = NULL, content_type = $2, size_bytes = $3,
+				storage_key = $4, url = $5, width = $6, height = $7, blurhash = $8
+			WHERE id = $1 AND status = 'processing';
+		`
+
+		res, err := tx.ExecContext(
+			ctx,
+			query,
+			media.ID,
+			media.ContentType,
+			media.Size,
+			media.StorageKey,
+			media.URL,
+			media.Width,
+			media.Height,
+			media.Blurhash,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rows == 0 {
+			return ErrNotFound
+		}
+
+		query = `
+			INSERT INTO media_variants (media_id, name, content_type, size_bytes, width, height, storage_key, url)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT (media_id, name) DO UPDATE
+			SET content_type = EXCLUDED.content_type, size_bytes = EXCLUDED.size_bytes,
+				width = EXCLUDED.width, height = EXCLUDED.height,
+				storage_key = EXCLUDED.storage_key, url = EXCLUDED.url;
+		`
+
+		for _, v := range variants {
+			_, err := tx.ExecContext(ctx, query, media.ID, v.Name, v.ContentType, v.Size, v.Width, v.Height, v.StorageKey, v.URL)
+			if err != nil {
+				return err
+			}
+		}
+
+		media.Status = MediaReady
+		media.Variants = variants
+
+		return nil
+	})
+}
+
+// FailProcessing releases the image after a failed attempt. It is retried
+// at retryAt, or marked as failed for good when retryAt is nil.
+func (s *MediaStore) FailProcessing(ctx context.Context, id int64, retryAt *time.Time) error {
+	query := `
+		UPDATE media
+		SET status = CASE WHEN $2::timestamptz IS NULL THEN 'failed' ELSE 'pending' END,
+			next_attempt_at = COALESCE($2, next_attempt_at),
+			claimed_at = NULL
+		WHERE id = $1 AND status = 'processing';
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, id, retryAt)
+
+	return err
+}
+
+// loadVariants fills in the variants of the media.
+func loadVariants(ctx context.Context, q querier, media []Media) error {
+	if len(media) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(media))
+	index := make(map[int64]int, len(media))
+
+	for i := range media {
+		ids[i] = media[i].ID
+		index[media[i].ID] = i
+		media[i].Variants = []MediaVariant{}
+	}
+
+	query := `
+		SELECT media_id, name, content_type, size_bytes, width, height, storage_key, url
+		FROM media_variants
+		WHERE media_id = ANY($1)
+		ORDER BY media_id, width;
+	`
+
+	rows, err := q.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var mediaID int64
+		var v MediaVariant
+
+		err := rows.Scan(
+			&mediaID,
+			&v.Name,
+			&v.ContentType,
+			&v.Size,
+			&v.Width,
+			&v.Height,
+			&v.StorageKey,
+			&v.URL,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		i := index[mediaID]
+		media[i].Variants = append(media[i].Variants, v)
+	}
+
+	return rows.Err()
+}
+
+// attachMedia attaches the media set on the post, identified by their ids,
+// and fills in the rest of their fields. It returns ErrInvalidAttachment
+// unless every one of them was uploaded by the author and is not attached
+// yet.
+func attachMedia(ctx context.Context, tx *sql.Tx, post *Post) error {
+	if len(post.Media) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(post.Media))
+	for i, m := range post.Media {
+		ids[i] = m.ID
+	}
+
+	query := `
+		UPDATE media SET post_id = $1, position = array_position($2::bigint[], id)
+		WHERE id = ANY($2) AND user_id = $3 AND post_id IS NULL
+		RETURNING ` + mediaColumns + `, position;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := tx.QueryContext(ctx, query, post.ID, pq.Array(ids), post.UserID)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	attached := make([]Media, len(ids))
+	count := 0
+
+	for rows.Next() {
+		var m Media
+		var position int
+
+		if err := scanMedia(rows, &m, &position); err != nil {
+			return err
+		}
+
+		attached[position-1] = m
+		count++
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if count != len(ids) {
+		return ErrInvalidAttachment
+	}
+
+	post.Media = attached
+
+	return loadVariants(ctx, tx, post.Media)
+}
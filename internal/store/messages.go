@@ -0,0 +1,474 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// Conversation is a private 1:1 or group conversation. UnreadCount and
+// LastMessage are relative to the member viewing it.
+type Conversation struct {
+	ID          int64               `json:"id"`
+	CreatedBy   int64               `json:"created_by"`
+	CreatedAt   string              `json:"created_at"`
+	UpdatedAt   string              `json:"updated_at"`
+	Members     ConversationMembers `json:"members"`
+	UnreadCount int                 `json:"unread_count"`
+	LastMessage *Message            `json:"last_message"`
+}
+
+// ConversationMembers lists the users taking part in a conversation.
+type ConversationMembers []User
+
+// Scan decodes the JSON array built by conversationColumns.
+func (m *ConversationMembers) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*m = ConversationMembers{}
+		return nil
+	case []byte:
+		return json.Unmarshal(v, m)
+	case string:
+		return json.Unmarshal([]byte(v), m)
+	default:
+		return fmt.Errorf("cannot scan %T into ConversationMembers", src)
+	}
+}
+
+type Message struct {
+	ID             int64  `json:"id"`
+	ConversationID int64  `json:"conversation_id"`
+	SenderID       int64  `json:"sender_id"`
+	Content        string `json:"content"`
+	CreatedAt      string `json:"created_at"`
+	Sender         User   `json:"sender"`
+}
+
+type MessageStore struct {
+	db *sql.DB
+}
+
+// conversationColumns selects a conversation as seen by the member joined
+// as me, whose id is bound to the given placeholder.
+func conversationColumns(viewer string) string {
+	return `
+		c.id, c.created_by, c.created_at, c.updated_at,
+		(
+			SELECT json_agg(json_build_object('id', u.id, 'username', u.username) ORDER BY u.id)
+			FROM conversation_members cm
+			JOIN users u ON u.id = cm.user_id
+			WHERE cm.conversation_id = c.id
+		) AS members,
+		(
+			SELECT COUNT(*) FROM messages um
+			WHERE um.conversation_id = c.id
+				AND um.sender_id <> ` + viewer + `
+				AND um.id > COALESCE(me.last_read_message_id, 0)
+				AND ` + notBlockedClause("um.sender_id", viewer) + `
+		) AS unread_count,
+		lm.id, lm.sender_id, lm.content, lm.created_at
+	`
+}
+
+// conversationJoins joins the viewer's membership and the last message they
+// can see onto conversations c.
+func conversationJoins(viewer string) string {
+	return `
+		JOIN conversation_members me ON me.conversation_id = c.id AND me.user_id = ` + viewer + `
+		LEFT JOIN LATERAL (
+			SELECT m.id, m.sender_id, m.content, m.created_at FROM messages m
+			WHERE m.conversation_id = c.id AND ` + notBlockedClause("m.sender_id", viewer) + `
+			ORDER BY m.created_at DESC, m.id DESC
+			LIMIT 1
+		) lm ON true
+	`
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanConversation(row rowScanner) (*Conversation, error) {
+	c := new(Conversation)
+
+	var (
+		lastID        sql.NullInt64
+		lastSenderID  sql.NullInt64
+		lastContent   sql.NullString
+		lastCreatedAt sql.NullString
+	)
+
+	err := row.Scan(
+		&c.ID,
+		&c.CreatedBy,
+		&c.CreatedAt,
+		&c.UpdatedAt,
+		&c.Members,
+		&c.UnreadCount,
+		&lastID,
+		&lastSenderID,
+		&lastContent,
+		&lastCreatedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if lastID.Valid {
+		c.LastMessage = &Message{
+			ID:             lastID.Int64,
+			ConversationID: c.ID,
+			SenderID:       lastSenderID.Int64,
+			Content:        lastContent.String,
+			CreatedAt:      lastCreatedAt.String,
+		}
+
+		for _, member := range c.Members {
+			if member.ID == lastSenderID.Int64 {
+				c.LastMessage.Sender = member
+			}
+		}
+	}
+
+	return c, nil
+}
+
+// StartConversation returns the conversation between creatorID and the given
+// members, creating it unless it is a 1:1 conversation that already exists.
+// created tells which of the two happened. It returns ErrNotFound when one of
+// the members is not an active user and ErrBlocked when the creator and one
+// of the members have blocked each other.
+func (s *MessageStore) StartConversation(ctx context.Context, creatorID int64, memberIDs []int64) (conversation *Conversation, created bool, err error) {
+	err = withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		var found int
+		query := `SELECT COUNT(*) FROM users WHERE id = ANY($1) AND is_active;`
+
+		if err := tx.QueryRowContext(ctx, query, pq.Array(memberIDs)).Scan(&found); err != nil {
+			return err
+		}
+
+		if found != len(memberIDs) {
+			return ErrNotFound
+		}
+
+		var blocked bool
+		query = `
+			SELECT EXISTS (
+				SELECT 1 FROM user_blocks
+				WHERE (blocker_id = $1 AND blocked_id = ANY($2)) OR (blocked_id = $1 AND blocker_id = ANY($2))
+			);
+		`
+
+		if err := tx.QueryRowContext(ctx, query, creatorID, pq.Array(memberIDs)).Scan(&blocked); err != nil {
+			return err
+		}
+
+		if blocked {
+			return ErrBlocked
+		}
+
+		var conversationID int64
+
+		if len(memberIDs) == 1 {
+			// Concurrent requests for the same pair would otherwise both
+			// miss the conversation and create one each. The lock is
+			// released with the transaction.
+			query = `
+				SELECT pg_advisory_xact_lock(hashtextextended(
+					'conversation:' || LEAST($1::bigint, $2::bigint) || ':' || GREATEST($1::bigint, $2::bigint), 0
+				));
+			`
+
+			if _, err := tx.ExecContext(ctx, query, creatorID, memberIDs[0]); err != nil {
+				return err
+			}
+
+			query = `
+				SELECT cm.conversation_id FROM conversation_members cm
+				JOIN conversation_members other ON other.conversation_id = cm.conversation_id AND other.user_id = $2
+				WHERE
+					cm.user_id = $1 AND
+					NOT EXISTS (
+						SELECT 1 FROM conversation_members extra
+						WHERE extra.conversation_id = cm.conversation_id AND extra.user_id NOT IN ($1, $2)
+					)
+				ORDER BY cm.conversation_id
+				LIMIT 1;
+			`
+
+			err := tx.QueryRowContext(ctx, query, creatorID, memberIDs[0]).Scan(&conversationID)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+		}
+
+		if conversationID == 0 {
+			query = `INSERT INTO conversations (created_by) VALUES ($1) RETURNING id;`
+
+			if err := tx.QueryRowContext(ctx, query, creatorID).Scan(&conversationID); err != nil {
+				return err
+			}
+
+			query = `
+				INSERT INTO conversation_members (conversation_id, user_id)
+				SELECT $1, user_id FROM unnest($2::bigint[]) AS user_id
+				ON CONFLICT DO NOTHING;
+			`
+
+			allIDs := append([]int64{creatorID}, memberIDs...)
+
+			if _, err := tx.ExecContext(ctx, query, conversationID, pq.Array(allIDs)); err != nil {
+				return err
+			}
+
+			created = true
+		}
+
+		conversation, err = s.getConversation(ctx, tx, conversationID, creatorID)
+		return err
+	})
+
+	return conversation, created, err
+}
+
+// GetConversation returns a conversation the viewer is a member of, or
+// ErrNotFound.
+func (s *MessageStore) GetConversation(ctx context.Context, conversationID, viewerID int64) (*Conversation, error) {
+	return s.getConversation(ctx, s.db, conversationID, viewerID)
+}
+
+func (s *MessageStore) getConversation(ctx context.Context, q querier, conversationID, viewerID int64) (*Conversation, error) {
+	query := `
+		SELECT ` + conversationColumns("$2") + `
+		FROM conversations c
+		` + conversationJoins("$2") + `
+		WHERE c.id = $1;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	conversation, err := scanConversation(q.QueryRowContext(ctx, query, conversationID, viewerID))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return conversation, nil
+}
+
+// GetConversations returns a page of the user's conversations, most recently
+// active first.
+func (s *MessageStore) GetConversations(ctx context.Context, userID int64, q PaginatedQuery) ([]Conversation, error) {
+	query := `
+		SELECT ` + conversationColumns("$1") + `
+		FROM conversations c
+		` + conversationJoins("$1") + `
+		WHERE ($2::timestamptz IS NULL OR (c.updated_at, c.id) < ($2, $3))
+		ORDER BY c.updated_at DESC, c.id DESC
+		LIMIT $4;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	cursorCreatedAt, cursorID := q.Cursor.cursorArgs()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, cursorCreatedAt, cursorID, q.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	conversations := []Conversation{}
+
+	for rows.Next() {
+		c, err := scanConversation(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		conversations = append(conversations, *c)
+	}
+
+	return conversations, rows.Err()
+}
+
+// Send adds a message to a conversation, which also marks the conversation
+// as read for the sender. It returns ErrBlocked when the sender and another
+// member have blocked each other.
+func (s *MessageStore) Send(ctx context.Context, message *Message) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		var blocked bool
+		query := `
+			SELECT EXISTS (
+				SELECT 1 FROM conversation_members cm
+				WHERE cm.conversation_id = $1 AND cm.user_id <> $2
+					AND NOT ` + notBlockedClause("cm.user_id", "$2") + `
+			);
+		`
+
+		if err := tx.QueryRowContext(ctx, query, message.ConversationID, message.SenderID).Scan(&blocked); err != nil {
+			return err
+		}
+
+		if blocked {
+			return ErrBlocked
+		}
+
+		query = `
+			INSERT INTO messages (conversation_id, sender_id, content)
+			VALUES ($1, $2, $3) RETURNING id, created_at;
+		`
+
+		err := tx.QueryRowContext(
+			ctx,
+			query,
+			message.ConversationID,
+			message.SenderID,
+			message.Content,
+		).Scan(
+			&message.ID,
+			&message.CreatedAt,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		query = `UPDATE conversations SET updated_at = NOW() WHERE id = $1;`
+
+		if _, err := tx.ExecContext(ctx, query, message.ConversationID); err != nil {
+			return err
+		}
+
+		query = `
+			UPDATE conversation_members SET last_read_message_id = $3
+			WHERE conversation_id = $1 AND user_id = $2;
+		`
+
+		_, err = tx.ExecContext(ctx, query, message.ConversationID, message.SenderID, message.ID)
+		return err
+	})
+}
+
+// GetMessages returns a page of a conversation's messages, newest first.
+// Messages from users on either side of a block with the viewer are left
+// out.
+func (s *MessageStore) GetMessages(ctx context.Context, conversationID, viewerID int64, q PaginatedQuery) ([]Message, error) {
+	query := `
+		SELECT m.id, m.conversation_id, m.sender_id, m.content, m.created_at, u.id, u.username
+		FROM messages m
+		JOIN users u ON u.id = m.sender_id
+		WHERE
+			m.conversation_id = $1 AND
+			` + notBlockedClause("m.sender_id", "$5") + ` AND
+			($2::timestamptz IS NULL OR (m.created_at, m.id) < ($2, $3))
+		ORDER BY m.created_at DESC, m.id DESC
+		LIMIT $4;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	cursorCreatedAt, cursorID := q.Cursor.cursorArgs()
+
+	rows, err := s.db.QueryContext(ctx, query, conversationID, cursorCreatedAt, cursorID, q.Limit, viewerID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	messages := []Message{}
+
+	for rows.Next() {
+		var m Message
+
+		err := rows.Scan(
+			&m.ID,
+			&m.ConversationID,
+			&m.SenderID,
+			&m.Content,
+			&m.CreatedAt,
+			&m.Sender.ID,
+			&m.Sender.Username,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		messages = append(messages, m)
+	}
+
+	return messages, rows.Err()
+}
+
+func (s *MessageStore) GetByID(ctx context.Context, messageID int64) (*Message, error) {
+	query := `
+		SELECT m.id, m.conversation_id, m.sender_id, m.content, m.created_at, u.id, u.username
+		FROM messages m
+		JOIN users u ON u.id = m.sender_id
+		WHERE m.id = $1;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	m := new(Message)
+
+	err := s.db.QueryRowContext(ctx, query, messageID).Scan(
+		&m.ID,
+		&m.ConversationID,
+		&m.SenderID,
+		&m.Content,
+		&m.CreatedAt,
+		&m.Sender.ID,
+		&m.Sender.Username,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// MarkRead marks every message currently in the conversation as read by the
+// user.
+func (s *MessageStore) MarkRead(ctx context.Context, conversationID, userID int64) error {
+	query := `
+		UPDATE conversation_members
+		SET last_read_message_id = (SELECT MAX(id) FROM messages WHERE conversation_id = $1)
+		WHERE conversation_id = $1 AND user_id = $2;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, conversationID, userID)
+	return err
+}
@@ -0,0 +1,77 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestStartConversationReusesDirectConversation(t *testing.T) {
+	s, _ := newTestStorage(t)
+	ctx := context.Background()
+
+	alice := createTestUser(t, s, "conversation_alice")
+	bob := createTestUser(t, s, "conversation_bob")
+	carol := createTestUser(t, s, "conversation_carol")
+
+	// A group including both users is not their 1:1 conversation.
+	group, created, err := s.Messages.StartConversation(ctx, alice.ID, []int64{bob.ID, carol.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !created {
+		t.Fatal("group conversation was not created")
+	}
+
+	// Concurrent requests for the same pair must agree on a single
+	// conversation.
+	var wg sync.WaitGroup
+	ids := make([]int64, 4)
+	errs := make([]error, len(ids))
+
+	for i := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			creator, member := alice.ID, bob.ID
+			if i%2 == 1 {
+				creator, member = member, creator
+			}
+
+			conversation, _, err := s.Messages.StartConversation(ctx, creator, []int64{member})
+			if err != nil {
+				errs[i] = err
+				return
+			}
+
+			ids[i] = conversation.ID
+		}()
+	}
+
+	wg.Wait()
+
+	for i := range ids {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+
+		if ids[i] != ids[0] {
+			t.Fatalf("conversation ids = %v, want a single one", ids)
+		}
+	}
+
+	if ids[0] == group.ID {
+		t.Fatal("the group conversation was reused as a 1:1 conversation")
+	}
+
+	_, created, err = s.Messages.StartConversation(ctx, bob.ID, []int64{alice.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if created {
+		t.Error("existing 1:1 conversation was created again")
+	}
+}
@@ -0,0 +1,204 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+const (
+	NotificationFollow        = "follow"
+	NotificationFollowRequest = "follow_request"
+	NotificationComment       = "comment"
+	NotificationReply         = "reply"
+	NotificationMention       = "mention"
+	NotificationReaction      = "reaction"
+)
+
+// Notification tells a user that the actor followed them, asked to follow
+// them, commented on or reacted to their post, replied to their comment or
+// mentioned them. PostID and CommentID are set depending on the type.
+type Notification struct {
+	ID        int64   `json:"id"`
+	UserID    int64   `json:"user_id"`
+	Actor     User    `json:"actor"`
+	Type      string  `json:"type"`
+	PostID    *int64  `json:"post_id"`
+	CommentID *int64  `json:"comment_id"`
+	ReadAt    *string `json:"read_at"`
+	CreatedAt string  `json:"created_at"`
+}
+
+type NotificationStore struct {
+	db *sql.DB
+}
+
+// GetByUserID returns a page of a user's notifications, most recent first.
+// Notifications from users on either side of a block are left out.
+func (s *NotificationStore) GetByUserID(ctx context.Context, userID int64, q PaginatedQuery) ([]Notification, error) {
+	query := `
+		SELECT n.id, n.user_id, n.type, n.post_id, n.comment_id, n.read_at, n.created_at, u.id, u.username
+		FROM notifications n
+		JOIN users u ON u.id = n.actor_id
+		WHERE
+			n.user_id = $1 AND
+			` + notBlockedClause("n.actor_id", "$1") + ` AND
+			($2::timestamptz IS NULL OR (n.created_at, n.id) < ($2, $3))
+		ORDER BY n.created_at DESC, n.id DESC
+		LIMIT $4;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	cursorCreatedAt, cursorID := q.Cursor.cursorArgs()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, cursorCreatedAt, cursorID, q.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	notifications := []Notification{}
+
+	for rows.Next() {
+		var n Notification
+		if err := scanNotification(rows, &n); err != nil {
+			return nil, err
+		}
+
+		notifications = append(notifications, n)
+	}
+
+	return notifications, rows.Err()
+}
+
+func (s *NotificationStore) GetByID(ctx context.Context, notificationID int64) (*Notification, error) {
+	query := `
+		SELECT n.id, n.user_id, n.type, n.post_id, n.comment_id, n.read_at, n.created_at, u.id, u.username
+		FROM notifications n
+		JOIN users u ON u.id = n.actor_id
+		WHERE n.id = $1;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	n := new(Notification)
+
+	if err := scanNotification(s.db.QueryRowContext(ctx, query, notificationID), n); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return n, nil
+}
+
+func scanNotification(row rowScanner, n *Notification) error {
+	var readAt sql.NullString
+
+	err := row.Scan(
+		&n.ID,
+		&n.UserID,
+		&n.Type,
+		&n.PostID,
+		&n.CommentID,
+		&readAt,
+		&n.CreatedAt,
+		&n.Actor.ID,
+		&n.Actor.Username,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	if readAt.Valid {
+		n.ReadAt = &readAt.String
+	}
+
+	return nil
+}
+
+func (s *NotificationStore) CountUnread(ctx context.Context, userID int64) (int, error) {
+	query := `
+		SELECT COUNT(*) FROM notifications n
+		WHERE n.user_id = $1 AND n.read_at IS NULL AND ` + notBlockedClause("n.actor_id", "$1") + `;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var count int
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(&count)
+
+	return count, err
+}
+
+// MarkRead marks one of the user's notifications as read. Marking it again is
+// a no-op.
+func (s *NotificationStore) MarkRead(ctx context.Context, userID, notificationID int64) error {
+	query := `
+		UPDATE notifications SET read_at = COALESCE(read_at, NOW())
+		WHERE id = $1 AND user_id = $2;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, notificationID, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *NotificationStore) MarkAllRead(ctx context.Context, userID int64) error {
+	query := `
+		UPDATE notifications SET read_at = NOW()
+		WHERE user_id = $1 AND read_at IS NULL;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID)
+	return err
+}
+
+// notify records a notification of typ from actorID to the user selected by
+// recipient, an expression that may refer to recipientArg as $1. Nothing is
+// recorded when there is no recipient, when it is the actor itself or when
+// either of them has blocked the other.
+func notify(ctx context.Context, q querier, typ, recipient string, recipientArg any, actorID int64, postID, commentID *int64) error {
+	query := `
+		INSERT INTO notifications (user_id, actor_id, type, post_id, comment_id)
+		SELECT r.id, $2, $3, $4, $5
+		FROM (SELECT ` + recipient + ` AS id) r
+		WHERE
+			r.id IS NOT NULL AND
+			r.id <> $2 AND
+			` + notBlockedClause("r.id", "$2") + `;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := q.ExecContext(ctx, query, recipientArg, actorID, typ, postID, commentID)
+	return err
+}
@@ -0,0 +1,147 @@
+package store
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cursor is a keyset pagination position. Listings are ordered by
+// (created_at, id) so that rows inserted while paging never shift a page.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        int64
+}
+
+// cursorArgs returns the cursor as nullable query arguments.
+func (c *Cursor) cursorArgs() (*time.Time, *int64) {
+	if c == nil {
+		return nil, nil
+	}
+
+	return &c.CreatedAt, &c.ID
+}
+
+type PaginatedQuery struct {
+	Limit  int     `json:"limit" validate:"gte=1,lte=50"`
+	Cursor *Cursor `json:"-"`
+}
+
+func (q PaginatedQuery) Parse(r *http.Request) (PaginatedQuery, error) {
+	limit := r.URL.Query().Get("limit")
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return q, err
+		}
+
+		q.Limit = l
+	}
+
+	return q, nil
+}
+
+type PaginatedFeedQuery struct {
+	Limit  int        `json:"limit" validate:"gte=1,lte=20"`
+	Cursor *Cursor    `json:"-"`
+	Sort   string     `json:"sort" validate:"oneof=asc desc"`
+	Tags   []string   `json:"tags" validate:"max=5,dive,max=50"`
+	Search string     `json:"search" validate:"max=100"`
+	Since  *time.Time `json:"since"`
+	Until  *time.Time `json:"until"`
+}
+
+func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error) {
+	qs := r.URL.Query()
+
+	limit := qs.Get("limit")
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return fq, err
+		}
+
+		fq.Limit = l
+	}
+
+	// The feed is only paged with cursors. Ignoring an offset would serve
+	// the same page again.
+	if qs.Has("offset") {
+		return fq, errors.New("the feed is paginated with cursors, offset is not supported")
+	}
+
+	sort := qs.Get("sort")
+	if sort != "" {
+		fq.Sort = sort
+	}
+
+	tags := qs.Get("tags")
+	if tags != "" {
+		fq.Tags = strings.Split(tags, ",")
+	}
+
+	search := qs.Get("search")
+	if search != "" {
+		fq.Search = search
+	}
+
+	since := qs.Get("since")
+	if since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return fq, err
+		}
+
+		fq.Since = &t
+	}
+
+	until := qs.Get("until")
+	if until != "" {
+		t, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			return fq, err
+		}
+
+		fq.Until = &t
+	}
+
+	if fq.Since != nil && fq.Until != nil && fq.Until.Before(*fq.Since) {
+		return fq, errors.New("until must not be before since")
+	}
+
+	return fq, nil
+}
+
+type PaginatedCommentsQuery struct {
+	Limit  int     `json:"limit" validate:"gte=1,lte=50"`
+	Cursor *Cursor `json:"-"`
+	Depth  int     `json:"depth" validate:"gte=0"`
+}
+
+func (q PaginatedCommentsQuery) Parse(r *http.Request) (PaginatedCommentsQuery, error) {
+	qs := r.URL.Query()
+
+	limit := qs.Get("limit")
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return q, err
+		}
+
+		q.Limit = l
+	}
+
+	depth := qs.Get("depth")
+	if depth != "" {
+		d, err := strconv.Atoi(depth)
+		if err != nil {
+			return q, err
+		}
+
+		q.Depth = d
+	}
+
+	return q, nil
+}
@@ -0,0 +1,25 @@
+package store
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPaginatedFeedQueryRejectsOffset(t *testing.T) {
+	r := httptest.NewRequest("GET", "/v1/users/feed?limit=5&offset=10", nil)
+
+	if _, err := (PaginatedFeedQuery{Limit: 20, Sort: "desc"}).Parse(r); err == nil {
+		t.Fatal("err = nil, want an error for the offset")
+	}
+
+	r = httptest.NewRequest("GET", "/v1/users/feed?limit=5", nil)
+
+	fq, err := (PaginatedFeedQuery{Limit: 20, Sort: "desc"}).Parse(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fq.Limit != 5 {
+		t.Errorf("limit = %d, want 5", fq.Limit)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
@@ -20,6 +21,23 @@ type Post struct {
 	Version   int       `json:"version"`
 	Comments  []Comment `json:"comments"`
 	User      User      `json:"user"`
+
+	Reactions      ReactionCounts `json:"reactions"`
+	ViewerReaction *string        `json:"viewer_reaction"`
+
+	QuotedPostID *int64 `json:"quoted_post_id"`
+	RepostsCount int    `json:"reposts_count"`
+
+	Hashtags []string  `json:"hashtags"`
+	Mentions []Mention `json:"mentions"`
+
+	Media []Media `json:"media"`
+}
+
+// Mention is a user referenced with @username in a post's content.
+type Mention struct {
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
 }
 
 type PostWithMetaData struct {
@@ -27,26 +45,61 @@ type PostWithMetaData struct {
 	CommentCount int `json:"comments_count"`
 }
 
+// FeedPost is a row of a user's feed. Posts that reached the feed through a
+// repost carry the reposter, and FeedAt is the time of the repost rather than
+// of the post.
+type FeedPost struct {
+	PostWithMetaData
+	RepostedBy *User  `json:"reposted_by"`
+	FeedAt     string `json:"feed_at"`
+}
+
 type PostStore struct {
-	db *sql.DB
+	db       *sql.DB
+	timeline *TimelineStore
 }
 
+// Create inserts the post along with its hashtags and mentions, and attaches
+// the media set on it.
 func (s *PostStore) Create(ctx context.Context, post *Post) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := s.create(ctx, tx, post); err != nil {
+			return err
+		}
+
+		if err := attachMedia(ctx, tx, post); err != nil {
+			return err
+		}
+
+		if err := s.saveEntities(ctx, tx, post); err != nil {
+			return err
+		}
+
+		if s.timeline == nil {
+			return nil
+		}
+
+		return s.timeline.fanOut(ctx, tx, post.ID)
+	})
+}
+
+func (s *PostStore) create(ctx context.Context, q querier, post *Post) error {
 	query := `
-		INSERT INTO posts (content, title, user_id, tags)
-		VALUES($1, $2, $3, $4) RETURNING id, created_at, updated_at
+		INSERT INTO posts (content, title, user_id, tags, quoted_post_id)
+		VALUES($1, $2, $3, $4, $5) RETURNING id, created_at, updated_at
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	err := s.db.QueryRowContext(
+	err := q.QueryRowContext(
 		ctx,
 		query,
 		post.Content,
 		post.Title,
 		post.UserID,
 		pq.Array(post.Tags),
+		post.QuotedPostID,
 	).Scan(
 		&post.ID,
 		&post.CreatedAt,
@@ -60,7 +113,11 @@ func (s *PostStore) GetById(ctx context.Context, postId int) (*Post, error) {
 	var post *Post = new(Post)
 
 	query := `
-		SELECT * FROM posts WHERE id = $1;
+		SELECT
+			p.id, p.title, p.user_id, p.content, p.created_at, p.tags, p.updated_at, p.version,
+			p.quoted_post_id, ` + repostsCountColumn("p.id") + `
+		FROM posts p
+		WHERE p.id = $1;
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
@@ -82,6 +139,8 @@ func (s *PostStore) GetById(ctx context.Context, postId int) (*Post, error) {
 		pq.Array(&post.Tags),
 		&updated_at,
 		&post.Version,
+		&post.QuotedPostID,
+		&post.RepostsCount,
 	)
 
 	post.CreatedAt = created_at.Format(time.RFC3339)
@@ -99,107 +158,435 @@ func (s *PostStore) GetById(ctx context.Context, postId int) (*Post, error) {
 	return post, nil
 }
 
+// Delete removes a post along with the entries saving it in collections.
 func (s *PostStore) Delete(c context.Context, postID int) error {
+	return withTx(s.db, c, func(tx *sql.Tx) error {
+		c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+		defer cancel()
+
+		if err := deleteSavedPost(c, tx, int64(postID)); err != nil {
+			return err
+		}
+
+		query := `
+			DELETE FROM posts WHERE id = $1 RETURNING id, title, content, user_id;
+		`
+
+		res, err := tx.ExecContext(
+			c,
+			query,
+			postID,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rows == 0 {
+			return ErrNotFound
+		}
+
+		return nil
+	})
+}
+
+// Patch updates the post's title and content and replaces its hashtags and
+// mentions with the current ones.
+func (s *PostStore) Patch(c context.Context, post *Post) error {
+	return withTx(s.db, c, func(tx *sql.Tx) error {
+		query := `
+			UPDATE posts
+			SET title = $1, content = $2, version = version+1
+			WHERE id = $3 AND version = $4
+			RETURNING version;
+		`
+
+		ctx, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+		defer cancel()
+
+		err := tx.QueryRowContext(ctx, query, post.Title, post.Content, post.ID, post.Version).Scan(&post.Version)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		return s.saveEntities(c, tx, post)
+	})
+}
+
+// saveEntities replaces the stored hashtags and mentions of a post with the
+// ones set on it. Users mentioned for the first time are notified, provided
+// they are allowed to see the post.
+func (s *PostStore) saveEntities(ctx context.Context, tx *sql.Tx, post *Post) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM post_hashtags WHERE post_id = $1;`, post.ID); err != nil {
+		return err
+	}
+
 	query := `
-		DELETE FROM posts WHERE id = $1 RETURNING id, title, content, user_id;
+		INSERT INTO post_hashtags (post_id, tag)
+		SELECT $1, tag FROM unnest($2::text[]) AS tag
+		ON CONFLICT DO NOTHING;
 	`
 
-	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
-	defer cancel()
+	if _, err := tx.ExecContext(ctx, query, post.ID, pq.Array(post.Hashtags)); err != nil {
+		return err
+	}
 
-	res, err := s.db.ExecContext(
-		c,
-		query,
-		postID,
-	)
+	userIDs := make([]int64, len(post.Mentions))
+	for i, m := range post.Mentions {
+		userIDs[i] = m.UserID
+	}
 
-	if err != nil {
+	query = `
+		DELETE FROM post_mentions WHERE post_id = $1 AND user_id <> ALL($2::bigint[]);
+	`
+
+	if _, err := tx.ExecContext(ctx, query, post.ID, pq.Array(userIDs)); err != nil {
 		return err
 	}
 
-	rows, err := res.RowsAffected()
+	query = `
+		WITH added AS (
+			INSERT INTO post_mentions (post_id, user_id)
+			SELECT $1, user_id FROM unnest($2::bigint[]) AS user_id
+			ON CONFLICT DO NOTHING
+			RETURNING user_id
+		)
+		INSERT INTO notifications (user_id, actor_id, type, post_id)
+		SELECT a.user_id, u.id, $3, $1
+		FROM added a
+		JOIN users u ON u.id = $4
+		WHERE a.user_id <> u.id AND ` + visibleToViewerClause("a.user_id") + `;
+	`
+
+	_, err := tx.ExecContext(ctx, query, post.ID, pq.Array(userIDs), NotificationMention, post.UserID)
+	return err
+}
+
+// feedSourceClause restricts posts to the ones in the feed of the user bound
+// to $1, reading from precomputed timelines when they are enabled.
+func (s *PostStore) feedSourceClause() string {
+	if s.timeline != nil {
+		return s.timeline.sourceClause()
+	}
+
+	return `(
+		p.user_id = $1 OR
+		p.user_id IN (SELECT f.user_id FROM followers f WHERE f.follower_id = $1)
+	)`
+}
+
+// feedRepostClause restricts reposts under the given alias to the ones that
+// reach the feed of the user bound to $1: those by followed, unmuted accounts.
+func feedRepostClause(alias string) string {
+	return `(
+		` + alias + `.user_id IN (SELECT f.user_id FROM followers f WHERE f.follower_id = $1) AND
+		NOT EXISTS (SELECT 1 FROM user_mutes m WHERE m.muter_id = $1 AND m.muted_id = ` + alias + `.user_id)
+	)`
+}
+
+// likeEscaper escapes the characters that are special in LIKE patterns, using
+// the default escape character.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// containsPattern returns a LIKE pattern matching the text anywhere, taken
+// literally.
+func containsPattern(text string) string {
+	return "%" + likeEscaper.Replace(text) + "%"
+}
+
+// GetUserFeed returns the user's own posts together with the posts of every
+// user they follow and the posts those users reposted. Follow requests on
+// private accounts only count once accepted, since they are not stored in
+// followers until then. Posts from muted users are left out, and so are
+// reposts by muted users. A post that reached the feed several times is only
+// listed once, at its latest appearance. Comment counts are computed per post
+// so that they are not inflated by the follower join.
+func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]FeedPost, error) {
+	// Sort is validated to be either asc or desc, so it is safe to
+	// interpolate along with the matching keyset comparison.
+	cmp := "<"
+	if fq.Sort == "asc" {
+		cmp = ">"
+	}
+
+	// Both kinds of entries are filtered, keyset paginated and limited on
+	// their own indexes before they are merged. Only the latest appearance
+	// of each post qualifies, which keeps a post from showing up again on a
+	// later page through an older appearance.
+	postFilters := visibleToViewerClause("$1") + ` AND
+		NOT EXISTS (SELECT 1 FROM user_mutes m WHERE m.muter_id = $1 AND m.muted_id = p.user_id) AND
+		(p.title ILIKE $3 OR p.content ILIKE $3) AND
+		(p.tags @> $4 OR $4 = '{}')`
+
+	query := `
+		WITH feed AS (
+			(
+				SELECT p.id AS post_id, p.created_at AS feed_at, NULL::bigint AS reposter_id
+				FROM posts p
+				JOIN users u ON u.id = p.user_id
+				WHERE
+					` + s.feedSourceClause() + ` AND
+					` + postFilters + ` AND
+					NOT EXISTS (
+						SELECT 1 FROM reposts nr
+						WHERE nr.post_id = p.id AND nr.created_at >= p.created_at AND ` + feedRepostClause("nr") + `
+					) AND
+					($5::timestamptz IS NULL OR p.created_at >= $5) AND
+					($6::timestamptz IS NULL OR p.created_at <= $6) AND
+					($7::timestamptz IS NULL OR (p.created_at, p.id) ` + cmp + ` ($7, $8))
+				ORDER BY p.created_at ` + fq.Sort + `, p.id ` + fq.Sort + `
+				LIMIT $2
+			)
+			UNION ALL
+			(
+				SELECT rp.post_id, rp.created_at, rp.user_id
+				FROM reposts rp
+				JOIN posts p ON p.id = rp.post_id
+				JOIN users u ON u.id = p.user_id
+				WHERE
+					` + feedRepostClause("rp") + ` AND
+					` + postFilters + ` AND
+					NOT EXISTS (
+						SELECT 1 FROM reposts nr
+						WHERE nr.post_id = rp.post_id AND (nr.created_at, nr.user_id) > (rp.created_at, rp.user_id) AND
+							` + feedRepostClause("nr") + `
+					) AND
+					($5::timestamptz IS NULL OR rp.created_at >= $5) AND
+					($6::timestamptz IS NULL OR rp.created_at <= $6) AND
+					($7::timestamptz IS NULL OR (rp.created_at, rp.post_id) ` + cmp + ` ($7, $8))
+				ORDER BY rp.created_at ` + fq.Sort + `, rp.post_id ` + fq.Sort + `
+				LIMIT $2
+			)
+		)
+		SELECT
+			p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags, p.quoted_post_id,
+			u.username,
+			(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id) AS comments_count,
+			` + reactionCountsColumn("p.id") + ` AS reactions,
+			` + viewerReactionColumn("p.id", "$1") + ` AS viewer_reaction,
+			` + repostsCountColumn("p.id") + ` AS reposts_count,
+			fd.feed_at, ru.id, ru.username
+		FROM feed fd
+		JOIN posts p ON p.id = fd.post_id
+		JOIN users u ON p.user_id = u.id
+		LEFT JOIN users ru ON ru.id = fd.reposter_id
+		ORDER BY fd.feed_at ` + fq.Sort + `, p.id ` + fq.Sort + `
+		LIMIT $2;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	cursorCreatedAt, cursorID := fq.Cursor.cursorArgs()
+
+	// A nil slice would be sent as NULL and match no post at all.
+	tags := fq.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		query,
+		userID,
+		fq.Limit,
+		containsPattern(fq.Search),
+		pq.Array(tags),
+		fq.Since,
+		fq.Until,
+		cursorCreatedAt,
+		cursorID,
+	)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if rows == 0 {
-		return ErrNotFound
+	defer rows.Close()
+
+	feed := []FeedPost{}
+
+	for rows.Next() {
+		var post FeedPost
+		var viewerReaction sql.NullString
+		var reposterID sql.NullInt64
+		var reposterUsername sql.NullString
+
+		err := rows.Scan(
+			&post.ID,
+			&post.UserID,
+			&post.Title,
+			&post.Content,
+			&post.CreatedAt,
+			&post.Version,
+			pq.Array(&post.Tags),
+			&post.QuotedPostID,
+			&post.User.Username,
+			&post.CommentCount,
+			&post.Reactions,
+			&viewerReaction,
+			&post.RepostsCount,
+			&post.FeedAt,
+			&reposterID,
+			&reposterUsername,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if viewerReaction.Valid {
+			post.ViewerReaction = &viewerReaction.String
+		}
+
+		if reposterID.Valid {
+			post.RepostedBy = &User{ID: reposterID.Int64, Username: reposterUsername.String}
+		}
+
+		feed = append(feed, post)
 	}
 
-	return nil
+	return feed, rows.Err()
 }
 
-func (s *PostStore) Patch(c context.Context, post *Post) error {
+// visibleToViewerClause limits rows to authors u whose posts the viewer
+// bound to the given placeholder may see: public accounts, the viewer
+// themselves and private accounts they have an accepted follow on, as long
+// as neither side has blocked the other.
+func visibleToViewerClause(viewer string) string {
+	return `(
+		(
+			NOT u.is_private OR
+			u.id = ` + viewer + ` OR
+			EXISTS (SELECT 1 FROM followers vf WHERE vf.user_id = u.id AND vf.follower_id = ` + viewer + `)
+		) AND
+		` + notBlockedClause("u.id", viewer) + `
+	)`
+}
+
+// IsVisibleTo reports whether the viewer may see the post.
+func (s *PostStore) IsVisibleTo(ctx context.Context, post *Post, viewerID int64) (bool, error) {
 	query := `
-		UPDATE posts
-		SET title = $1, content = $2, version = version+1
-		WHERE id = $3 AND version = $4
-		RETURNING version;
+		SELECT ` + visibleToViewerClause("$2") + `
+		FROM users u
+		WHERE u.id = $1;
 	`
 
-	c, cancel := context.WithTimeout(c, QueryTimeoutDuration)
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	err := s.db.QueryRowContext(c, query, post.Title, post.Content, post.ID, post.Version).Scan(&post.Version)
+	var visible bool
+
+	err := s.db.QueryRowContext(ctx, query, post.UserID, viewerID).Scan(&visible)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
-			return ErrNotFound
+			return false, nil
 		default:
-			return err
+			return false, err
 		}
 	}
 
-	return nil
+	return visible, nil
+}
+
+// GetByUserID returns a page of the posts written by a user, newest first.
+// Posts of private accounts are only returned to the viewer when allowed.
+func (s *PostStore) GetByUserID(ctx context.Context, userID, viewerID int64, q PaginatedQuery) ([]PostWithMetaData, error) {
+	return s.getPage(ctx, `p.user_id = $1`, userID, viewerID, q)
+}
+
+// GetByTag returns a page of the posts using a hashtag that the viewer may
+// see, newest first.
+func (s *PostStore) GetByTag(ctx context.Context, tag string, viewerID int64, q PaginatedQuery) ([]PostWithMetaData, error) {
+	filter := `EXISTS (SELECT 1 FROM post_hashtags ph WHERE ph.post_id = p.id AND ph.tag = $1)`
+	return s.getPage(ctx, filter, tag, viewerID, q)
 }
 
-func (s *PostStore) GetUserFeed(ctx context.Context, userID int64) ([]PostWithMetaData, error) {
+// GetMentioning returns a page of the posts mentioning a user that the viewer
+// may see, newest first.
+func (s *PostStore) GetMentioning(ctx context.Context, userID, viewerID int64, q PaginatedQuery) ([]PostWithMetaData, error) {
+	filter := `EXISTS (SELECT 1 FROM post_mentions pm WHERE pm.post_id = p.id AND pm.user_id = $1)`
+	return s.getPage(ctx, filter, userID, viewerID, q)
+}
+
+// getPage returns a page of the posts matching filter, newest first, leaving
+// out the ones the viewer may not see. The filter refers to arg as $1.
+func (s *PostStore) getPage(ctx context.Context, filter string, arg any, viewerID int64, q PaginatedQuery) ([]PostWithMetaData, error) {
 	query := `
-		SELECT 
-			p.id, p.user_id, p.title, p.content, p.version, p.tags,
+		SELECT
+			p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags, p.quoted_post_id,
 			u.username,
-			COUNT(c.id) AS comments_count
+			(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id) AS comments_count,
+			` + reactionCountsColumn("p.id") + ` AS reactions,
+			` + viewerReactionColumn("p.id", "$5") + ` AS viewer_reaction,
+			` + repostsCountColumn("p.id") + ` AS reposts_count
 		FROM posts p
-		LEFT JOIN comments c ON c.post_id = p.id
-		LEFT JOIN users u ON p.user_id = u.id
-		JOIN followers f ON f.follower_id = p.user_id OR p.user_id = $1
-		WHERE f.user_id = $1 OR p.user_id = $1
-		GROUP BY p.id, u.username
-		ORDER BY p.created_at DESC;
+		JOIN users u ON p.user_id = u.id
+		WHERE
+			` + filter + ` AND
+			` + visibleToViewerClause("$5") + ` AND
+			($2::timestamptz IS NULL OR (p.created_at, p.id) < ($2, $3))
+		ORDER BY p.created_at DESC, p.id DESC
+		LIMIT $4;
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	rows, err := s.db.QueryContext(ctx, query, userID)
+	cursorCreatedAt, cursorID := q.Cursor.cursorArgs()
+
+	rows, err := s.db.QueryContext(ctx, query, arg, cursorCreatedAt, cursorID, q.Limit, viewerID)
 	if err != nil {
 		return nil, err
 	}
 
 	defer rows.Close()
 
-	var feed []PostWithMetaData
+	posts := []PostWithMetaData{}
 
 	for rows.Next() {
 		var post PostWithMetaData
+		var viewerReaction sql.NullString
 
 		err := rows.Scan(
 			&post.ID,
 			&post.UserID,
 			&post.Title,
 			&post.Content,
+			&post.CreatedAt,
 			&post.Version,
 			pq.Array(&post.Tags),
+			&post.QuotedPostID,
 			&post.User.Username,
 			&post.CommentCount,
+			&post.Reactions,
+			&viewerReaction,
+			&post.RepostsCount,
 		)
 
-		feed = append(feed, post)
-
 		if err != nil {
 			return nil, err
 		}
+
+		if viewerReaction.Valid {
+			post.ViewerReaction = &viewerReaction.String
+		}
+
+		posts = append(posts, post)
 	}
 
-	return feed, nil
+	return posts, rows.Err()
 }
@@ -0,0 +1,294 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func feedTitles(feed []FeedPost) []string {
+	titles := make([]string, len(feed))
+	for i, post := range feed {
+		titles[i] = post.Title
+	}
+
+	return titles
+}
+
+func equalTitles(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestGetUserFeedSources(t *testing.T) {
+	s, db := newTestStorage(t)
+	ctx := context.Background()
+
+	viewer := createTestUser(t, s, "feed_sources_viewer")
+	followed := createTestUser(t, s, "feed_sources_followed")
+	stranger := createTestUser(t, s, "feed_sources_stranger")
+
+	if err := s.Followers.Follow(ctx, viewer.ID, followed.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Following the viewer back must not pull the viewer's followers into
+	// their feed.
+	if err := s.Followers.Follow(ctx, stranger.ID, viewer.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	createTestPost(t, s, db, viewer, "own", base)
+	createTestPost(t, s, db, followed, "followed", base.Add(time.Minute))
+	createTestPost(t, s, db, stranger, "stranger", base.Add(2*time.Minute))
+
+	feed, err := s.Posts.GetUserFeed(ctx, viewer.ID, PaginatedFeedQuery{Limit: 20, Sort: "desc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"followed", "own"}
+	if got := feedTitles(feed); !equalTitles(got, want) {
+		t.Fatalf("feed = %v, want %v", got, want)
+	}
+
+	if feed[0].User.Username != followed.Username {
+		t.Errorf("author = %q, want %q", feed[0].User.Username, followed.Username)
+	}
+}
+
+func TestGetUserFeedReposts(t *testing.T) {
+	s, db := newTestStorage(t)
+	ctx := context.Background()
+
+	viewer := createTestUser(t, s, "feed_reposts_viewer")
+	alice := createTestUser(t, s, "feed_reposts_alice")
+	bob := createTestUser(t, s, "feed_reposts_bob")
+	stranger := createTestUser(t, s, "feed_reposts_stranger")
+
+	for _, user := range []*User{alice, bob} {
+		if err := s.Followers.Follow(ctx, viewer.ID, user.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	strangerPost := createTestPost(t, s, db, stranger, "stranger", base)
+	alicePost := createTestPost(t, s, db, alice, "alice", base.Add(time.Minute))
+	createTestPost(t, s, db, bob, "bob", base.Add(2*time.Minute))
+
+	// Reposts by the stranger never reach the feed. The stranger's post does
+	// through the repost of a followed user, and a post that appears several
+	// times is only listed at its latest appearance.
+	createTestRepost(t, s, db, stranger, alicePost, base.Add(5*time.Minute))
+	createTestRepost(t, s, db, alice, strangerPost, base.Add(3*time.Minute))
+	createTestRepost(t, s, db, bob, alicePost, base.Add(4*time.Minute))
+
+	feed, err := s.Posts.GetUserFeed(ctx, viewer.ID, PaginatedFeedQuery{Limit: 20, Sort: "desc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"alice", "stranger", "bob"}
+	if got := feedTitles(feed); !equalTitles(got, want) {
+		t.Fatalf("feed = %v, want %v", got, want)
+	}
+
+	if feed[0].RepostedBy == nil || feed[0].RepostedBy.ID != bob.ID {
+		t.Errorf("alice's post reposted by %+v, want bob", feed[0].RepostedBy)
+	}
+
+	if feed[1].RepostedBy == nil || feed[1].RepostedBy.ID != alice.ID {
+		t.Errorf("stranger's post reposted by %+v, want alice", feed[1].RepostedBy)
+	}
+
+	if feed[2].RepostedBy != nil {
+		t.Errorf("bob's post reposted by %+v, want none", feed[2].RepostedBy)
+	}
+
+	// Walking the feed one entry at a time must list every post exactly once
+	// in the same order.
+	var walked []string
+	var cursor *Cursor
+
+	for range len(want) + 1 {
+		page, err := s.Posts.GetUserFeed(ctx, viewer.ID, PaginatedFeedQuery{Limit: 1, Sort: "desc", Cursor: cursor})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(page) == 0 {
+			break
+		}
+
+		feedAt, err := time.Parse(time.RFC3339, page[0].FeedAt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		walked = append(walked, page[0].Title)
+		cursor = &Cursor{CreatedAt: feedAt, ID: page[0].ID}
+	}
+
+	if !equalTitles(walked, want) {
+		t.Fatalf("paged feed = %v, want %v", walked, want)
+	}
+}
+
+func TestGetUserFeedMutes(t *testing.T) {
+	s, db := newTestStorage(t)
+	ctx := context.Background()
+
+	viewer := createTestUser(t, s, "feed_mutes_viewer")
+	muted := createTestUser(t, s, "feed_mutes_muted")
+	followed := createTestUser(t, s, "feed_mutes_followed")
+
+	for _, user := range []*User{muted, followed} {
+		if err := s.Followers.Follow(ctx, viewer.ID, user.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.Blocks.Mute(ctx, viewer.ID, muted.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	mutedPost := createTestPost(t, s, db, muted, "muted", base)
+	followedPost := createTestPost(t, s, db, followed, "followed", base.Add(time.Minute))
+
+	// The muted user's repost is ignored, and so is the repost of their post.
+	createTestRepost(t, s, db, muted, followedPost, base.Add(2*time.Minute))
+	createTestRepost(t, s, db, followed, mutedPost, base.Add(3*time.Minute))
+
+	feed, err := s.Posts.GetUserFeed(ctx, viewer.ID, PaginatedFeedQuery{Limit: 20, Sort: "desc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"followed"}
+	if got := feedTitles(feed); !equalTitles(got, want) {
+		t.Fatalf("feed = %v, want %v", got, want)
+	}
+
+	if feed[0].RepostedBy != nil {
+		t.Errorf("followed post reposted by %+v, want none", feed[0].RepostedBy)
+	}
+}
+
+func TestGetUserFeedCommentCounts(t *testing.T) {
+	s, db := newTestStorage(t)
+	ctx := context.Background()
+
+	viewer := createTestUser(t, s, "feed_comments_viewer")
+	author := createTestUser(t, s, "feed_comments_author")
+
+	// Every follower of the author used to multiply the comment counts.
+	for _, name := range []string{"feed_comments_follower_1", "feed_comments_follower_2", "feed_comments_follower_3"} {
+		follower := createTestUser(t, s, name)
+
+		if err := s.Followers.Follow(ctx, follower.ID, author.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.Followers.Follow(ctx, viewer.ID, author.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	want := map[string]int{"none": 0, "one": 1, "three": 3}
+	posts := map[string]*Post{
+		"none":  createTestPost(t, s, db, author, "none", base),
+		"one":   createTestPost(t, s, db, author, "one", base.Add(time.Minute)),
+		"three": createTestPost(t, s, db, viewer, "three", base.Add(2*time.Minute)),
+	}
+
+	for title, post := range posts {
+		for range want[title] {
+			if err := s.Comments.Create(ctx, &Comment{PostID: post.ID, UserID: author.ID, Content: "comment"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	feed, err := s.Posts.GetUserFeed(ctx, viewer.ID, PaginatedFeedQuery{Limit: 20, Sort: "desc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(feed) != len(want) {
+		t.Fatalf("feed = %v, want %d posts", feedTitles(feed), len(want))
+	}
+
+	for _, post := range feed {
+		if post.CommentCount != want[post.Title] {
+			t.Errorf("%s: %d comments, want %d", post.Title, post.CommentCount, want[post.Title])
+		}
+	}
+}
+
+func TestContainsPattern(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"", "%%"},
+		{"go", "%go%"},
+		{"100%", `%100\%%`},
+		{"snake_case", `%snake\_case%`},
+		{`C:\dir`, `%C:\\dir%`},
+	}
+
+	for _, tt := range tests {
+		if got := containsPattern(tt.text); got != tt.want {
+			t.Errorf("containsPattern(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestGetUserFeedSearchIsLiteral(t *testing.T) {
+	s, db := newTestStorage(t)
+	ctx := context.Background()
+
+	viewer := createTestUser(t, s, "feed_search_viewer")
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	createTestPost(t, s, db, viewer, "100% organic", base)
+	createTestPost(t, s, db, viewer, "snake_case", base.Add(time.Minute))
+	createTestPost(t, s, db, viewer, "plain", base.Add(2*time.Minute))
+
+	tests := []struct {
+		search string
+		want   []string
+	}{
+		{"%", []string{"100% organic"}},
+		{"_", []string{"snake_case"}},
+		{"", []string{"plain", "snake_case", "100% organic"}},
+	}
+
+	for _, tt := range tests {
+		feed, err := s.Posts.GetUserFeed(ctx, viewer.ID, PaginatedFeedQuery{Limit: 20, Sort: "desc", Search: tt.search})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := feedTitles(feed); !equalTitles(got, tt.want) {
+			t.Errorf("search %q: feed = %v, want %v", tt.search, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// Reaction is a user's reaction to a post. Type is one of like, love, laugh,
+// wow, sad or angry.
+type Reaction struct {
+	PostID    int64  `json:"post_id"`
+	UserID    int64  `json:"user_id"`
+	Type      string `json:"type"`
+	CreatedAt string `json:"created_at"`
+}
+
+// ReactionCounts maps a reaction type to the number of users who left it.
+type ReactionCounts map[string]int
+
+// Scan decodes the JSON object built by reactionCountsColumn.
+func (c *ReactionCounts) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*c = ReactionCounts{}
+		return nil
+	case []byte:
+		return json.Unmarshal(v, c)
+	case string:
+		return json.Unmarshal([]byte(v), c)
+	default:
+		return fmt.Errorf("cannot scan %T into ReactionCounts", src)
+	}
+}
+
+// reactionCountsColumn selects the per-type reaction counts of a post as a
+// JSON object.
+func reactionCountsColumn(postID string) string {
+	return `(
+		SELECT COALESCE(jsonb_object_agg(rc.type, rc.count), '{}')
+		FROM (
+			SELECT pr.type, COUNT(*) AS count FROM post_reactions pr
+			WHERE pr.post_id = ` + postID + `
+			GROUP BY pr.type
+		) rc
+	)`
+}
+
+// viewerReactionColumn selects the viewer's own reaction to a post, if any.
+func viewerReactionColumn(postID, viewer string) string {
+	return `(
+		SELECT pr.type FROM post_reactions pr
+		WHERE pr.post_id = ` + postID + ` AND pr.user_id = ` + viewer + `
+	)`
+}
+
+type ReactionStore struct {
+	db *sql.DB
+}
+
+// Upsert sets the user's reaction to a post, replacing any previous one.
+// Repeating the same reaction is a no-op. The post author is only notified
+// the first time the user reacts.
+func (s *ReactionStore) Upsert(ctx context.Context, reaction *Reaction) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			INSERT INTO post_reactions (post_id, user_id, type) VALUES ($1, $2, $3)
+			ON CONFLICT (post_id, user_id) DO UPDATE SET type = EXCLUDED.type
+			RETURNING created_at, xmax = 0;
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		var inserted bool
+
+		err := tx.QueryRowContext(
+			ctx,
+			query,
+			reaction.PostID,
+			reaction.UserID,
+			reaction.Type,
+		).Scan(
+			&reaction.CreatedAt,
+			&inserted,
+		)
+
+		if err != nil || !inserted {
+			return err
+		}
+
+		postAuthor := `(SELECT user_id FROM posts WHERE id = $1)`
+
+		return notify(ctx, tx, NotificationReaction, postAuthor, reaction.PostID, reaction.UserID, &reaction.PostID, nil)
+	})
+}
+
+func (s *ReactionStore) Delete(ctx context.Context, postID, userID int64) error {
+	query := `
+		DELETE FROM post_reactions WHERE post_id = $1 AND user_id = $2;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, postID, userID)
+	return err
+}
+
+// GetSummary returns the reaction counts of a post and the viewer's own
+// reaction, which is nil when they have not reacted.
+func (s *ReactionStore) GetSummary(ctx context.Context, postID, viewerID int64) (ReactionCounts, *string, error) {
+	query := `
+		SELECT ` + reactionCountsColumn("$1") + `, ` + viewerReactionColumn("$1", "$2") + `;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var counts ReactionCounts
+	var viewerReaction sql.NullString
+
+	err := s.db.QueryRowContext(ctx, query, postID, viewerID).Scan(&counts, &viewerReaction)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !viewerReaction.Valid {
+		return counts, nil, nil
+	}
+
+	return counts, &viewerReaction.String, nil
+}
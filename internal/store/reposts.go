@@ -0,0 +1,57 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Repost is a plain re-share of another user's post. Quote posts are regular
+// posts with QuotedPostID set instead.
+type Repost struct {
+	UserID    int64  `json:"user_id"`
+	PostID    int64  `json:"post_id"`
+	CreatedAt string `json:"created_at"`
+}
+
+// repostsCountColumn selects the number of times a post was reposted.
+func repostsCountColumn(postID string) string {
+	return `(SELECT COUNT(*) FROM reposts rp WHERE rp.post_id = ` + postID + `)`
+}
+
+type RepostStore struct {
+	db *sql.DB
+}
+
+// Create reposts a post. Reposting the same post again is a no-op and keeps
+// the original repost time.
+func (s *RepostStore) Create(ctx context.Context, repost *Repost) error {
+	query := `
+		INSERT INTO reposts (user_id, post_id) VALUES ($1, $2)
+		ON CONFLICT (user_id, post_id) DO UPDATE SET created_at = reposts.created_at
+		RETURNING created_at;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return s.db.QueryRowContext(
+		ctx,
+		query,
+		repost.UserID,
+		repost.PostID,
+	).Scan(
+		&repost.CreatedAt,
+	)
+}
+
+func (s *RepostStore) Delete(ctx context.Context, userID, postID int64) error {
+	query := `
+		DELETE FROM reposts WHERE user_id = $1 AND post_id = $2;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID, postID)
+	return err
+}
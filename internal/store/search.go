@@ -0,0 +1,205 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/lib/pq"
+)
+
+// SearchStore looks up posts and users matching a free-text query. It is an
+// interface so that a dedicated search engine can replace PostgreSQL.
+type SearchStore interface {
+	SearchPosts(ctx context.Context, viewerID int64, q SearchQuery) ([]PostSearchResult, error)
+	SearchUsers(ctx context.Context, viewerID int64, q SearchQuery) ([]UserSearchResult, error)
+}
+
+type SearchQuery struct {
+	Query  string `json:"q" validate:"required,max=100"`
+	Type   string `json:"type" validate:"oneof=posts users"`
+	Limit  int    `json:"limit" validate:"gte=1,lte=50"`
+	Offset int    `json:"offset" validate:"gte=0"`
+}
+
+func (q SearchQuery) Parse(r *http.Request) (SearchQuery, error) {
+	qs := r.URL.Query()
+
+	q.Query = qs.Get("q")
+
+	typ := qs.Get("type")
+	if typ != "" {
+		q.Type = typ
+	}
+
+	limit := qs.Get("limit")
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return q, err
+		}
+
+		q.Limit = l
+	}
+
+	offset := qs.Get("offset")
+	if offset != "" {
+		o, err := strconv.Atoi(offset)
+		if err != nil {
+			return q, err
+		}
+
+		q.Offset = o
+	}
+
+	return q, nil
+}
+
+// PostSearchResult is a post matching a search, with an excerpt of its
+// content.
+type PostSearchResult struct {
+	PostWithMetaData
+	Rank float64 `json:"rank"`
+	// Snippet is HTML: the excerpt is escaped and the matched terms are
+	// wrapped in <mark> tags, so it can be rendered as it is.
+	Snippet string `json:"snippet"`
+}
+
+type UserSearchResult struct {
+	ID        int64   `json:"id"`
+	Username  string  `json:"username"`
+	IsPrivate bool    `json:"is_private"`
+	Rank      float64 `json:"rank"`
+	// Snippet is the username as HTML, like PostSearchResult.Snippet.
+	Snippet string `json:"snippet"`
+}
+
+const headlineOptions = `StartSel=<mark>, StopSel=</mark>, MaxWords=35, MinWords=15, MaxFragments=2`
+
+// escapedHTML escapes the text column for use in HTML, so that the <mark>
+// tags added by ts_headline are the only markup in a snippet.
+func escapedHTML(column string) string {
+	return `replace(replace(replace(replace(replace(` + column + `,
+		'&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&quot;'), '''', '&#39;')`
+}
+
+// PostgresSearchStore searches the tsvector columns kept on posts and users.
+type PostgresSearchStore struct {
+	db *sql.DB
+}
+
+// SearchPosts returns the posts the viewer may see whose title or content
+// match the query, best matches first. Title matches weigh more than content
+// matches.
+func (s *PostgresSearchStore) SearchPosts(ctx context.Context, viewerID int64, q SearchQuery) ([]PostSearchResult, error) {
+	query := `
+		SELECT
+			p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags, p.quoted_post_id,
+			u.username,
+			(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id) AS comments_count,
+			` + reactionCountsColumn("p.id") + ` AS reactions,
+			` + viewerReactionColumn("p.id", "$2") + ` AS viewer_reaction,
+			` + repostsCountColumn("p.id") + ` AS reposts_count,
+			ts_rank(p.search_vector, sq.query) AS rank,
+			ts_headline('english', ` + escapedHTML("p.content") + `, sq.query, '` + headlineOptions + `') AS snippet
+		FROM posts p
+		JOIN users u ON p.user_id = u.id
+		CROSS JOIN websearch_to_tsquery('english', $1) AS sq(query)
+		WHERE
+			p.search_vector @@ sq.query AND
+			` + visibleToViewerClause("$2") + `
+		ORDER BY rank DESC, p.created_at DESC, p.id DESC
+		LIMIT $3 OFFSET $4;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, q.Query, viewerID, q.Limit, q.Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	results := []PostSearchResult{}
+
+	for rows.Next() {
+		var res PostSearchResult
+		var viewerReaction sql.NullString
+
+		err := rows.Scan(
+			&res.ID,
+			&res.UserID,
+			&res.Title,
+			&res.Content,
+			&res.CreatedAt,
+			&res.Version,
+			pq.Array(&res.Tags),
+			&res.QuotedPostID,
+			&res.User.Username,
+			&res.CommentCount,
+			&res.Reactions,
+			&viewerReaction,
+			&res.RepostsCount,
+			&res.Rank,
+			&res.Snippet,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if viewerReaction.Valid {
+			res.ViewerReaction = &viewerReaction.String
+		}
+
+		results = append(results, res)
+	}
+
+	return results, rows.Err()
+}
+
+// SearchUsers returns the active users whose username matches the query,
+// leaving out users on either side of a block with the viewer.
+func (s *PostgresSearchStore) SearchUsers(ctx context.Context, viewerID int64, q SearchQuery) ([]UserSearchResult, error) {
+	query := `
+		SELECT
+			u.id, u.username, u.is_private,
+			ts_rank(u.search_vector, sq.query) AS rank,
+			ts_headline('simple', ` + escapedHTML("u.username") + `, sq.query, '` + headlineOptions + `') AS snippet
+		FROM users u
+		CROSS JOIN websearch_to_tsquery('simple', $1) AS sq(query)
+		WHERE
+			u.search_vector @@ sq.query AND
+			u.is_active AND
+			` + notBlockedClause("u.id", "$2") + `
+		ORDER BY rank DESC, u.username, u.id
+		LIMIT $3 OFFSET $4;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, q.Query, viewerID, q.Limit, q.Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	results := []UserSearchResult{}
+
+	for rows.Next() {
+		var res UserSearchResult
+
+		if err := rows.Scan(&res.ID, &res.Username, &res.IsPrivate, &res.Rank, &res.Snippet); err != nil {
+			return nil, err
+		}
+
+		results = append(results, res)
+	}
+
+	return results, rows.Err()
+}
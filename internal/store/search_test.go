@@ -0,0 +1,45 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSearchPostsEscapesSnippet(t *testing.T) {
+	s, db := newTestStorage(t)
+
+	author := createTestUser(t, s, "search_snippet_author")
+	post := createTestPost(t, s, db, author, "snippet", time.Now())
+
+	content := `<img src=x onerror="alert('x')"> escaping & highlighting`
+
+	if _, err := db.Exec(`UPDATE posts SET content = $2 WHERE id = $1;`, post.ID, content); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := s.Search.SearchPosts(context.Background(), author.ID, SearchQuery{Query: "highlighting", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 1 {
+		t.Fatalf("got %d results, want 1", len(results))
+	}
+
+	snippet := results[0].Snippet
+
+	// The only markup left must be the highlight.
+	if markup := strings.ReplaceAll(strings.ReplaceAll(snippet, "<mark>", ""), "</mark>", ""); strings.ContainsAny(markup, `<>"'`) {
+		t.Errorf("snippet %q contains unescaped markup", snippet)
+	}
+
+	if !strings.Contains(snippet, "&lt;img") || !strings.Contains(snippet, "&amp;") {
+		t.Errorf("snippet %q is not escaped", snippet)
+	}
+
+	if !strings.Contains(snippet, "<mark>highlighting</mark>") {
+		t.Errorf("snippet %q does not highlight the match", snippet)
+	}
+}
@@ -19,30 +19,171 @@ type Storage struct {
 		GetById(context.Context, int) (*Post, error)
 		Delete(context.Context, int) error
 		Patch(context.Context, *Post) error
-		GetUserFeed(context.Context, int64) ([]PostWithMetaData, error)
+		GetUserFeed(context.Context, int64, PaginatedFeedQuery) ([]FeedPost, error)
+		GetByUserID(ctx context.Context, userID, viewerID int64, q PaginatedQuery) ([]PostWithMetaData, error)
+		IsVisibleTo(ctx context.Context, post *Post, viewerID int64) (bool, error)
+		GetByTag(ctx context.Context, tag string, viewerID int64, q PaginatedQuery) ([]PostWithMetaData, error)
+		GetMentioning(ctx context.Context, userID, viewerID int64, q PaginatedQuery) ([]PostWithMetaData, error)
 	}
 
 	Users interface {
 		Create(context.Context, *User) error
 		GetUserById(context.Context, int) (*User, error)
+		GetByEmail(context.Context, string) (*User, error)
+		GetByUsernames(context.Context, []string) ([]User, error)
+		CreateAndInvite(ctx context.Context, user *User, token string, exp time.Duration) error
+		Activate(ctx context.Context, token string) error
+		Delete(context.Context, int64) error
+		GetProfile(ctx context.Context, user *User, viewerID int64) (*UserProfile, error)
+		UpdatePrivacy(context.Context, *User) error
+		GetByUsername(context.Context, string) (*User, error)
+		UpdateProfile(ctx context.Context, user *User, cooldown time.Duration) error
+		RequestEmailChange(ctx context.Context, userID int64, email, token string, exp time.Duration) error
+		IsEmailTaken(context.Context, string) (bool, error)
+		ConfirmEmailChange(ctx context.Context, token string) error
 	}
 
 	Comments interface {
 		Create(context.Context, *Comment) error
-		GetByPostId(ctx context.Context, postID int64) ([]Comment, error)
+		GetByID(context.Context, int64) (*Comment, error)
+		GetByPostId(ctx context.Context, postID, viewerID int64, q PaginatedCommentsQuery) ([]Comment, error)
+		GetReplies(ctx context.Context, parent *Comment, viewerID int64, q PaginatedCommentsQuery) ([]Comment, error)
+		Update(context.Context, *Comment) error
+		Delete(context.Context, int64) error
 	}
 
 	Followers interface {
 		Follow(context.Context, int64, int64) error
 		Unfollow(context.Context, int64, int64) error
+		GetFollowers(ctx context.Context, userID, viewerID int64, q PaginatedQuery) ([]FollowEntry, error)
+		GetFollowing(ctx context.Context, userID, viewerID int64, q PaginatedQuery) ([]FollowEntry, error)
+		RequestFollow(ctx context.Context, followerID, userID int64) error
+		AcceptRequest(ctx context.Context, userID, requesterID int64) error
+		RejectRequest(ctx context.Context, userID, requesterID int64) error
+		GetFollowRequests(ctx context.Context, userID int64, q PaginatedQuery) ([]FollowRequest, error)
+		GetFeedAuthorIDs(context.Context, int64) ([]int64, error)
+	}
+
+	Blocks interface {
+		Block(ctx context.Context, userID, blockedID int64) error
+		Unblock(ctx context.Context, userID, blockedID int64) error
+		Mute(ctx context.Context, userID, mutedID int64) error
+		Unmute(ctx context.Context, userID, mutedID int64) error
+	}
+
+	Reactions interface {
+		Upsert(context.Context, *Reaction) error
+		Delete(ctx context.Context, postID, userID int64) error
+		GetSummary(ctx context.Context, postID, viewerID int64) (ReactionCounts, *string, error)
+	}
+
+	Reposts interface {
+		Create(context.Context, *Repost) error
+		Delete(ctx context.Context, userID, postID int64) error
+	}
+
+	Collections interface {
+		Create(context.Context, *Collection) error
+		GetByID(context.Context, int64) (*Collection, error)
+		GetByUserID(context.Context, int64) ([]Collection, error)
+		Delete(context.Context, int64) error
+		AddPost(ctx context.Context, collectionID, postID int64) error
+		RemovePost(ctx context.Context, collectionID, postID int64) error
+		GetPosts(ctx context.Context, collectionID, viewerID int64, q PaginatedQuery) ([]SavedPost, error)
+	}
+
+	Media interface {
+		Create(context.Context, *Media) error
+		GetByPostID(context.Context, int64) ([]Media, error)
+		GetByPostIDs(context.Context, []int64) (map[int64][]Media, error)
+		GetProcessable(ctx context.Context, staleAfter time.Duration, limit int) ([]int64, error)
+		ClaimForProcessing(ctx context.Context, id int64, staleAfter time.Duration) (*Media, error)
+		CompleteProcessing(context.Context, *Media, []MediaVariant) error
+		FailProcessing(ctx context.Context, id int64, retryAt *time.Time) error
+	}
+
+	Messages interface {
+		StartConversation(ctx context.Context, creatorID int64, memberIDs []int64) (*Conversation, bool, error)
+		GetConversation(ctx context.Context, conversationID, viewerID int64) (*Conversation, error)
+		GetConversations(ctx context.Context, userID int64, q PaginatedQuery) ([]Conversation, error)
+		Send(context.Context, *Message) error
+		GetByID(context.Context, int64) (*Message, error)
+		GetMessages(ctx context.Context, conversationID, viewerID int64, q PaginatedQuery) ([]Message, error)
+		MarkRead(ctx context.Context, conversationID, userID int64) error
+	}
+
+	Notifications interface {
+		GetByUserID(ctx context.Context, userID int64, q PaginatedQuery) ([]Notification, error)
+		GetByID(context.Context, int64) (*Notification, error)
+		CountUnread(context.Context, int64) (int, error)
+		MarkRead(ctx context.Context, userID, notificationID int64) error
+		MarkAllRead(context.Context, int64) error
+	}
+
+	Trending interface {
+		Refresh(context.Context) error
+		GetTags(context.Context, TrendingQuery) ([]TrendingTag, error)
+		GetPosts(ctx context.Context, viewerID int64, q TrendingQuery) ([]TrendingPost, error)
+	}
+
+	Search SearchStore
+
+	Roles interface {
+		GetByName(context.Context, string) (*Role, error)
+	}
+
+	Timelines interface {
+		Rebuild(context.Context, int64) error
+		RebuildAll(context.Context) error
 	}
 }
 
-func NewStorage(db *sql.DB) Storage {
+func NewStorage(db *sql.DB, timelineCfg TimelineConfig) Storage {
+	timelines := &TimelineStore{db, timelineCfg}
+
+	// Only hook fan-out-on-write into posts and follows when enabled.
+	var timeline *TimelineStore
+	if timelineCfg.Enabled {
+		timeline = timelines
+	}
+
 	return Storage{
-		Posts:     &PostStore{db},
-		Users:     &UserStore{db},
-		Comments:  &CommentStore{db},
-		Followers: &FollowerStore{db},
+		Posts:         &PostStore{db, timeline},
+		Users:         &UserStore{db},
+		Comments:      &CommentStore{db},
+		Followers:     &FollowerStore{db, timeline},
+		Blocks:        &BlockStore{db, timeline},
+		Reactions:     &ReactionStore{db},
+		Reposts:       &RepostStore{db},
+		Collections:   &CollectionStore{db},
+		Media:         &MediaStore{db},
+		Messages:      &MessageStore{db},
+		Notifications: &NotificationStore{db},
+		Trending:      &TrendingStore{db},
+		Search:        &PostgresSearchStore{db},
+		Roles:         &RoleStore{db},
+		Timelines:     timelines,
 	}
 }
+
+// querier is satisfied by both *sql.DB and *sql.Tx so that store methods can
+// run inside or outside of a transaction.
+type querier interface {
+	ExecContext(context.Context, string, ...any) (sql.Result, error)
+	QueryContext(context.Context, string, ...any) (*sql.Rows, error)
+	QueryRowContext(context.Context, string, ...any) *sql.Row
+}
+
+func withTx(db *sql.DB, ctx context.Context, fn func(*sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,22 @@
+-- The comments and followers tables and the tags, updated_at and version
+-- columns of posts predate the migrations, which only alter them. Existing
+-- databases already have them, so they are only created for the tests.
+ALTER TABLE posts
+    ADD COLUMN tags VARCHAR(100)[],
+    ADD COLUMN updated_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    ADD COLUMN version INT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS comments (
+    id BIGSERIAL PRIMARY KEY,
+    post_id BIGINT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    content TEXT NOT NULL,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS followers (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    follower_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, follower_id)
+);
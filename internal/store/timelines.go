@@ -0,0 +1,210 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+
+	"github.com/lib/pq"
+)
+
+type TimelineConfig struct {
+	// Enabled turns on fan-out-on-write. When disabled feeds are computed
+	// entirely at read time.
+	Enabled bool
+	// FanOutThreshold is the follower count above which an author's posts
+	// are not pushed to followers but read at query time instead.
+	FanOutThreshold int
+	// Capacity caps the number of entries kept in each user's timeline.
+	Capacity int
+}
+
+// TimelineStore maintains precomputed home timelines. Posts are pushed to the
+// timelines of the author and their followers when they are created, except
+// for authors above the fan-out threshold whose posts are merged in at read
+// time.
+type TimelineStore struct {
+	db  *sql.DB
+	cfg TimelineConfig
+}
+
+func (s *TimelineStore) fanOut(ctx context.Context, q querier, postID int64) error {
+	query := `
+		WITH post AS (
+			SELECT id, user_id, created_at FROM posts WHERE id = $1
+		), recipients AS (
+			SELECT user_id FROM post
+			UNION
+			SELECT f.follower_id FROM followers f, post
+			WHERE f.user_id = post.user_id
+				AND (SELECT COUNT(*) FROM followers hf WHERE hf.user_id = post.user_id) <= $2
+		)
+		INSERT INTO timelines (user_id, post_id, created_at)
+		SELECT r.user_id, post.id, post.created_at FROM recipients r, post
+		ON CONFLICT DO NOTHING
+		RETURNING user_id;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := q.QueryContext(ctx, query, postID, s.cfg.FanOutThreshold)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	var userIDs []int64
+
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+
+		userIDs = append(userIDs, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return s.trim(ctx, q, userIDs)
+}
+
+// backfillAuthor copies an author's most recent posts into a new follower's
+// timeline.
+func (s *TimelineStore) backfillAuthor(ctx context.Context, q querier, userID, authorID int64) error {
+	query := `
+		INSERT INTO timelines (user_id, post_id, created_at)
+		SELECT $1, p.id, p.created_at FROM posts p
+		WHERE p.user_id = $2
+			AND (SELECT COUNT(*) FROM followers hf WHERE hf.user_id = $2) <= $3
+		ORDER BY p.created_at DESC, p.id DESC
+		LIMIT $4
+		ON CONFLICT DO NOTHING;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if _, err := q.ExecContext(ctx, query, userID, authorID, s.cfg.FanOutThreshold, s.cfg.Capacity); err != nil {
+		return err
+	}
+
+	return s.trim(ctx, q, []int64{userID})
+}
+
+// removeAuthor drops an author's posts from a user's timeline, e.g. after an
+// unfollow.
+func (s *TimelineStore) removeAuthor(ctx context.Context, q querier, userID, authorID int64) error {
+	query := `
+		DELETE FROM timelines
+		WHERE user_id = $1 AND post_id IN (SELECT id FROM posts WHERE user_id = $2);
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := q.ExecContext(ctx, query, userID, authorID)
+	return err
+}
+
+func (s *TimelineStore) trim(ctx context.Context, q querier, userIDs []int64) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	query := `
+		DELETE FROM timelines t
+		USING (
+			SELECT user_id, post_id,
+				row_number() OVER (PARTITION BY user_id ORDER BY created_at DESC, post_id DESC) AS rn
+			FROM timelines
+			WHERE user_id = ANY($1)
+		) ranked
+		WHERE t.user_id = ranked.user_id AND t.post_id = ranked.post_id AND ranked.rn > $2;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := q.ExecContext(ctx, query, pq.Array(userIDs), s.cfg.Capacity)
+	return err
+}
+
+// sourceClause selects the ids of the posts that belong in the feed of the
+// user bound to $1: their precomputed timeline merged with the posts of
+// followed accounts that are above the fan-out threshold.
+func (s *TimelineStore) sourceClause() string {
+	return `p.id IN (
+		SELECT t.post_id FROM timelines t WHERE t.user_id = $1
+		UNION ALL
+		SELECT hp.id FROM posts hp
+		JOIN followers f ON f.user_id = hp.user_id AND f.follower_id = $1
+		WHERE (SELECT COUNT(*) FROM followers hf WHERE hf.user_id = hp.user_id) > ` + strconv.Itoa(s.cfg.FanOutThreshold) + `
+	)`
+}
+
+// Rebuild recomputes a user's timeline from scratch.
+func (s *TimelineStore) Rebuild(ctx context.Context, userID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM timelines WHERE user_id = $1;`, userID); err != nil {
+			return err
+		}
+
+		query := `
+			INSERT INTO timelines (user_id, post_id, created_at)
+			SELECT $1, p.id, p.created_at FROM posts p
+			WHERE p.user_id = $1 OR p.user_id IN (
+				SELECT f.user_id FROM followers f
+				WHERE f.follower_id = $1
+					AND (SELECT COUNT(*) FROM followers hf WHERE hf.user_id = f.user_id) <= $2
+			)
+			ORDER BY p.created_at DESC, p.id DESC
+			LIMIT $3;
+		`
+
+		_, err := tx.ExecContext(ctx, query, userID, s.cfg.FanOutThreshold, s.cfg.Capacity)
+		return err
+	})
+}
+
+// RebuildAll recomputes every user's timeline. It is meant for backfilling
+// after the subsystem is first enabled.
+func (s *TimelineStore) RebuildAll(ctx context.Context) error {
+	rows, err := s.db.QueryContext(ctx, `SELECT id FROM users ORDER BY id;`)
+	if err != nil {
+		return err
+	}
+
+	var userIDs []int64
+
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+
+		userIDs = append(userIDs, id)
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range userIDs {
+		if err := s.Rebuild(ctx, id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
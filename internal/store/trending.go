@@ -0,0 +1,239 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// TrendingWindows maps each supported trending window to its length.
+var TrendingWindows = map[string]time.Duration{
+	"1h":  time.Hour,
+	"24h": time.Hour * 24,
+	"7d":  time.Hour * 24 * 7,
+}
+
+const (
+	// trendingCapacity caps how many posts and tags are kept per window.
+	trendingCapacity = 100
+	// trendingGravity controls how fast older posts sink: the higher it is
+	// the more recency outweighs engagement.
+	trendingGravity = 1.5
+)
+
+type TrendingTag struct {
+	Tag        string  `json:"tag"`
+	Score      float64 `json:"score"`
+	PostsCount int     `json:"posts_count"`
+}
+
+type TrendingPost struct {
+	PostWithMetaData
+	Score float64 `json:"score"`
+}
+
+type TrendingQuery struct {
+	Window string `json:"window" validate:"oneof=1h 24h 7d"`
+	Limit  int    `json:"limit" validate:"gte=1,lte=50"`
+}
+
+func (q TrendingQuery) Parse(r *http.Request) (TrendingQuery, error) {
+	qs := r.URL.Query()
+
+	window := qs.Get("window")
+	if window != "" {
+		q.Window = window
+	}
+
+	limit := qs.Get("limit")
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return q, err
+		}
+
+		q.Limit = l
+	}
+
+	return q, nil
+}
+
+// TrendingStore keeps a summary of the highest scoring posts and tags of each
+// window so that reading them does not depend on the number of posts. A post
+// scores (1 + 2*comments + reactions + 3*reposts) / (age in hours + 2)^gravity,
+// counting only the activity that happened within the window, and a tag
+// scores the sum of the scores of the public posts using it.
+type TrendingStore struct {
+	db *sql.DB
+}
+
+// Refresh recomputes the summary of every window. The work grows with the
+// number of recent posts, so it is not bound by QueryTimeoutDuration: callers
+// limit it through ctx instead.
+func (s *TrendingStore) Refresh(ctx context.Context) error {
+	for window, length := range TrendingWindows {
+		if err := s.refreshWindow(ctx, window, length); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *TrendingStore) refreshWindow(ctx context.Context, window string, length time.Duration) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		since := time.Now().Add(-length)
+
+		scores := `
+			SELECT
+				p.id, p.user_id,
+				(
+					1 +
+					2 * (SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id AND c.created_at >= $2) +
+					(SELECT COUNT(*) FROM post_reactions pr WHERE pr.post_id = p.id AND pr.created_at >= $2) +
+					3 * (SELECT COUNT(*) FROM reposts rp WHERE rp.post_id = p.id AND rp.created_at >= $2)
+				) / power(EXTRACT(EPOCH FROM NOW() - p.created_at) / 3600 + 2, $3) AS score
+			FROM posts p
+			WHERE p.created_at >= $2
+		`
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM trending_posts WHERE period = $1;`, window); err != nil {
+			return err
+		}
+
+		query := `
+			INSERT INTO trending_posts (period, post_id, score)
+			SELECT $1, s.id, s.score FROM (` + scores + `) s
+			ORDER BY s.score DESC, s.id DESC
+			LIMIT $4;
+		`
+
+		if _, err := tx.ExecContext(ctx, query, window, since, trendingGravity, trendingCapacity); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM trending_tags WHERE period = $1;`, window); err != nil {
+			return err
+		}
+
+		query = `
+			INSERT INTO trending_tags (period, tag, score, posts_count)
+			SELECT $1, ph.tag, SUM(s.score), COUNT(*)
+			FROM (` + scores + `) s
+			JOIN users u ON u.id = s.user_id AND NOT u.is_private
+			JOIN post_hashtags ph ON ph.post_id = s.id
+			GROUP BY ph.tag
+			ORDER BY SUM(s.score) DESC, ph.tag
+			LIMIT $4;
+		`
+
+		_, err := tx.ExecContext(ctx, query, window, since, trendingGravity, trendingCapacity)
+		return err
+	})
+}
+
+// GetTags returns the top tags of a window.
+func (s *TrendingStore) GetTags(ctx context.Context, q TrendingQuery) ([]TrendingTag, error) {
+	query := `
+		SELECT tag, score, posts_count FROM trending_tags
+		WHERE period = $1
+		ORDER BY score DESC, tag
+		LIMIT $2;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, q.Window, q.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	tags := []TrendingTag{}
+
+	for rows.Next() {
+		var t TrendingTag
+
+		if err := rows.Scan(&t.Tag, &t.Score, &t.PostsCount); err != nil {
+			return nil, err
+		}
+
+		tags = append(tags, t)
+	}
+
+	return tags, rows.Err()
+}
+
+// GetPosts returns the top posts of a window that the viewer may see.
+func (s *TrendingStore) GetPosts(ctx context.Context, viewerID int64, q TrendingQuery) ([]TrendingPost, error) {
+	query := `
+		SELECT
+			p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags, p.quoted_post_id,
+			u.username,
+			(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id) AS comments_count,
+			` + reactionCountsColumn("p.id") + ` AS reactions,
+			` + viewerReactionColumn("p.id", "$3") + ` AS viewer_reaction,
+			` + repostsCountColumn("p.id") + ` AS reposts_count,
+			tp.score
+		FROM trending_posts tp
+		JOIN posts p ON p.id = tp.post_id
+		JOIN users u ON p.user_id = u.id
+		WHERE
+			tp.period = $1 AND
+			` + visibleToViewerClause("$3") + `
+		ORDER BY tp.score DESC, p.id DESC
+		LIMIT $2;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, q.Window, q.Limit, viewerID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	posts := []TrendingPost{}
+
+	for rows.Next() {
+		var post TrendingPost
+		var viewerReaction sql.NullString
+
+		err := rows.Scan(
+			&post.ID,
+			&post.UserID,
+			&post.Title,
+			&post.Content,
+			&post.CreatedAt,
+			&post.Version,
+			pq.Array(&post.Tags),
+			&post.QuotedPostID,
+			&post.User.Username,
+			&post.CommentCount,
+			&post.Reactions,
+			&viewerReaction,
+			&post.RepostsCount,
+			&post.Score,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if viewerReaction.Valid {
+			post.ViewerReaction = &viewerReaction.String
+		}
+
+		posts = append(posts, post)
+	}
+
+	return posts, rows.Err()
+}
@@ -2,8 +2,21 @@ package store
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
 	"errors"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrDuplicateEmail    = errors.New("a user with that email already exists")
+	ErrDuplicateUsername = errors.New("a user with that username already exists")
+	ErrUsernameCooldown  = errors.New("the username was changed too recently")
+	ErrInvalidAvatar     = errors.New("avatar must be an image uploaded by the user")
 )
 
 type User struct {
@@ -12,6 +25,34 @@ type User struct {
 	Email     string `json:"email"`
 	Password  string `json:"-"`
 	CreatedAt string `json:"created_at"`
+	IsActive  bool   `json:"is_active"`
+	IsPrivate bool   `json:"is_private"`
+	RoleID    int64  `json:"role_id"`
+	Role      Role   `json:"role"`
+
+	DisplayName   string  `json:"display_name"`
+	Bio           string  `json:"bio"`
+	Website       string  `json:"website"`
+	Location      string  `json:"location"`
+	AvatarMediaID *int64  `json:"avatar_media_id"`
+	AvatarURL     *string `json:"avatar_url"`
+
+	passwordHash []byte
+}
+
+// UserProfile is a user along with their social counters, as seen by the
+// viewer passed to GetProfile.
+type UserProfile struct {
+	User
+	FollowersCount int  `json:"followers_count"`
+	FollowingCount int  `json:"following_count"`
+	PostsCount     int  `json:"posts_count"`
+	IsFollowing    bool `json:"is_following"`
+}
+
+// ComparePassword reports whether text matches the user's stored bcrypt hash.
+func (u *User) ComparePassword(text string) error {
+	return bcrypt.CompareHashAndPassword(u.passwordHash, []byte(text))
 }
 
 type UserStore struct {
@@ -19,43 +60,226 @@ type UserStore struct {
 }
 
 func (s *UserStore) Create(ctx context.Context, user *User) error {
+	return s.create(ctx, s.db, user)
+}
+
+func (s *UserStore) create(ctx context.Context, q querier, user *User) error {
+	// Usernames given up by other users are still reserved for them.
 	query := `
-		INSERT INTO USERS (username, password, email) VALUES ($1, $2, $3) RETURNING id, created_at
+		INSERT INTO USERS (username, password, email, is_active, role_id)
+		SELECT $1, $2, $3, $4, (SELECT id FROM roles WHERE name = $5)
+		WHERE NOT EXISTS (SELECT 1 FROM username_redirects WHERE lower(old_username) = lower($1))
+		RETURNING id, created_at, role_id
 	`
 
+	role := user.Role.Name
+	if role == "" {
+		role = "user"
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	err := s.db.QueryRowContext(
+	err = q.QueryRowContext(
 		ctx,
 		query,
 		user.Username,
-		user.Password,
+		hash,
 		user.Email,
+		user.IsActive,
+		role,
 	).Scan(
 		&user.ID,
 		&user.CreatedAt,
+		&user.RoleID,
 	)
 
-	return err
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrDuplicateUsername
+		}
+
+		return uniqueViolation(err)
+	}
+
+	user.Password = ""
+	user.passwordHash = hash
+	user.Role.Name = role
+
+	return nil
 }
 
 func (s *UserStore) GetUserById(ctx context.Context, uid int) (*User, error) {
 	user := new(User)
 
 	query := `
-		SELECT id, email, username, created_at FROM users WHERE id = $1;
+		SELECT ` + userColumns + `
+		FROM users u
+		JOIN roles r ON r.id = u.role_id
+		WHERE u.id = $1;
 	`
 
-	err := s.db.QueryRowContext(
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := scanUser(s.db.QueryRowContext(
 		ctx,
 		query,
 		uid,
+	), user)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+// GetByUsername returns the user currently holding the username, or else
+// the one who gave it up, compared case-insensitively. Callers can tell the
+// two apart by comparing the usernames.
+func (s *UserStore) GetByUsername(ctx context.Context, username string) (*User, error) {
+	user := new(User)
+
+	query := `
+		SELECT ` + userColumns + `
+		FROM users u
+		JOIN roles r ON r.id = u.role_id
+		WHERE u.id = COALESCE(
+			(SELECT id FROM users WHERE lower(username) = lower($1) ORDER BY id LIMIT 1),
+			(SELECT user_id FROM username_redirects WHERE lower(old_username) = lower($1))
+		);
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := scanUser(s.db.QueryRowContext(ctx, query, username), user)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+// userColumns selects a user, their role and their avatar, preferring its
+// thumbnail. It expects users aliased as u and roles as r.
+const userColumns = `
+	u.id, u.email, u.username, u.created_at, u.is_active, u.is_private,
+	r.id, r.name, r.level, COALESCE(r.description, ''),
+	u.display_name, u.bio, u.website, u.location, u.avatar_media_id,
+	(
+		SELECT COALESCE(
+			(SELECT mv.url FROM media_variants mv WHERE mv.media_id = m.id AND mv.name = 'thumbnail'),
+			m.url
+		)
+		FROM media m WHERE m.id = u.avatar_media_id
+	)`
+
+func scanUser(row rowScanner, user *User) error {
+	err := row.Scan(
+		&user.ID,
+		&user.Email,
+		&user.Username,
+		&user.CreatedAt,
+		&user.IsActive,
+		&user.IsPrivate,
+		&user.Role.ID,
+		&user.Role.Name,
+		&user.Role.Level,
+		&user.Role.Description,
+		&user.DisplayName,
+		&user.Bio,
+		&user.Website,
+		&user.Location,
+		&user.AvatarMediaID,
+		&user.AvatarURL,
+	)
+
+	user.RoleID = user.Role.ID
+
+	return err
+}
+
+func (s *UserStore) GetProfile(ctx context.Context, user *User, viewerID int64) (*UserProfile, error) {
+	query := `
+		SELECT
+			(SELECT COUNT(*) FROM followers WHERE user_id = $1),
+			(SELECT COUNT(*) FROM followers WHERE follower_id = $1),
+			(SELECT COUNT(*) FROM posts WHERE user_id = $1),
+			EXISTS (SELECT 1 FROM followers WHERE user_id = $1 AND follower_id = $2);
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	profile := &UserProfile{User: *user}
+
+	err := s.db.QueryRowContext(ctx, query, user.ID, viewerID).Scan(
+		&profile.FollowersCount,
+		&profile.FollowingCount,
+		&profile.PostsCount,
+		&profile.IsFollowing,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return profile, nil
+}
+
+func (s *UserStore) UpdatePrivacy(ctx context.Context, user *User) error {
+	query := `
+		UPDATE users SET is_private = $1 WHERE id = $2;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, user.IsPrivate, user.ID)
+	return err
+}
+
+// GetByEmail only returns activated accounts so that unverified users
+// cannot log in.
+func (s *UserStore) GetByEmail(ctx context.Context, email string) (*User, error) {
+	user := new(User)
+
+	query := `
+		SELECT id, email, username, password, created_at, is_active FROM users
+		WHERE email = $1 AND is_active = true;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		email,
 	).Scan(
 		&user.ID,
 		&user.Email,
 		&user.Username,
+		&user.passwordHash,
 		&user.CreatedAt,
+		&user.IsActive,
 	)
 
 	if err != nil {
@@ -69,3 +293,385 @@ func (s *UserStore) GetUserById(ctx context.Context, uid int) (*User, error) {
 
 	return user, nil
 }
+
+// GetByUsernames returns the active users with the given usernames, compared
+// case-insensitively. Unknown usernames are ignored.
+func (s *UserStore) GetByUsernames(ctx context.Context, usernames []string) ([]User, error) {
+	query := `
+		SELECT id, username FROM users
+		WHERE lower(username) = ANY($1) AND is_active = true
+		ORDER BY id;
+	`
+
+	lowered := make([]string, len(usernames))
+	for i, username := range usernames {
+		lowered[i] = strings.ToLower(username)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(lowered))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	users := []User{}
+
+	for rows.Next() {
+		var user User
+
+		if err := rows.Scan(&user.ID, &user.Username); err != nil {
+			return nil, err
+		}
+
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+func (s *UserStore) CreateAndInvite(ctx context.Context, user *User, token string, exp time.Duration) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := s.create(ctx, tx, user); err != nil {
+			return err
+		}
+
+		return s.createUserInvitation(ctx, tx, token, exp, user.ID)
+	})
+}
+
+func (s *UserStore) createUserInvitation(ctx context.Context, tx *sql.Tx, token string, exp time.Duration, userID int64) error {
+	query := `
+		INSERT INTO user_invitations (token, user_id, expiry) VALUES ($1, $2, $3);
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, hashToken(token), userID, time.Now().Add(exp))
+	return err
+}
+
+func (s *UserStore) Activate(ctx context.Context, token string) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		user, err := s.getUserFromInvitation(ctx, tx, token)
+		if err != nil {
+			return err
+		}
+
+		user.IsActive = true
+		if err := s.update(ctx, tx, user); err != nil {
+			return err
+		}
+
+		return s.deleteUserInvitations(ctx, tx, user.ID)
+	})
+}
+
+func (s *UserStore) getUserFromInvitation(ctx context.Context, tx *sql.Tx, token string) (*User, error) {
+	query := `
+		SELECT u.id, u.username, u.email, u.created_at, u.is_active
+		FROM users u
+		JOIN user_invitations ui ON ui.user_id = u.id
+		WHERE ui.token = $1 AND ui.expiry > $2;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	user := new(User)
+
+	err := tx.QueryRowContext(ctx, query, hashToken(token), time.Now()).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.CreatedAt,
+		&user.IsActive,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+func (s *UserStore) update(ctx context.Context, tx *sql.Tx, user *User) error {
+	query := `
+		UPDATE users SET username = $1, email = $2, is_active = $3 WHERE id = $4;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, user.Username, user.Email, user.IsActive, user.ID)
+	return err
+}
+
+func (s *UserStore) deleteUserInvitations(ctx context.Context, tx *sql.Tx, userID int64) error {
+	query := `
+		DELETE FROM user_invitations WHERE user_id = $1;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, userID)
+	return err
+}
+
+// Delete removes a user along with any pending invitations. It is used to
+// roll back a registration when the invitation email could not be sent.
+func (s *UserStore) Delete(ctx context.Context, userID int64) error {
+	query := `
+		DELETE FROM users WHERE id = $1;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID)
+	return err
+}
+
+// UpdateProfile saves the profile fields, username and avatar of the user. A
+// new username must not be held or reserved by anyone else, and can only be
+// chosen once per cooldown. The old one is kept as a redirect to the user.
+func (s *UserStore) UpdateProfile(ctx context.Context, user *User, cooldown time.Duration) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		var username string
+		var changedAt *time.Time
+
+		query := `
+			SELECT username, username_changed_at FROM users WHERE id = $1 FOR UPDATE;
+		`
+
+		if err := tx.QueryRowContext(ctx, query, user.ID).Scan(&username, &changedAt); err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		if user.Username != username {
+			if err := s.changeUsername(ctx, tx, user.ID, username, user.Username, changedAt, cooldown); err != nil {
+				return err
+			}
+		}
+
+		if user.AvatarMediaID != nil {
+			var valid bool
+
+			query := `
+				SELECT EXISTS (SELECT 1 FROM media WHERE id = $1 AND user_id = $2 AND kind = 'image');
+			`
+
+			if err := tx.QueryRowContext(ctx, query, *user.AvatarMediaID, user.ID).Scan(&valid); err != nil {
+				return err
+			}
+
+			if !valid {
+				return ErrInvalidAvatar
+			}
+		}
+
+		query = `
+			UPDATE users
+			SET display_name = $1, bio = $2, website = $3, location = $4, avatar_media_id = $5
+			WHERE id = $6;
+		`
+
+		_, err := tx.ExecContext(
+			ctx,
+			query,
+			user.DisplayName,
+			user.Bio,
+			user.Website,
+			user.Location,
+			user.AvatarMediaID,
+			user.ID,
+		)
+
+		return err
+	})
+}
+
+func (s *UserStore) changeUsername(ctx context.Context, tx *sql.Tx, userID int64, from, to string, changedAt *time.Time, cooldown time.Duration) error {
+	if changedAt != nil && time.Since(*changedAt) < cooldown {
+		return ErrUsernameCooldown
+	}
+
+	var taken bool
+
+	query := `
+		SELECT
+			EXISTS (SELECT 1 FROM users WHERE lower(username) = lower($1) AND id <> $2) OR
+			EXISTS (SELECT 1 FROM username_redirects WHERE lower(old_username) = lower($1) AND user_id <> $2);
+	`
+
+	if err := tx.QueryRowContext(ctx, query, to, userID).Scan(&taken); err != nil {
+		return err
+	}
+
+	if taken {
+		return ErrDuplicateUsername
+	}
+
+	// Taking back a previous username turns its redirect back into the
+	// username itself.
+	query = `
+		DELETE FROM username_redirects WHERE lower(old_username) = lower($1);
+	`
+
+	if _, err := tx.ExecContext(ctx, query, to); err != nil {
+		return err
+	}
+
+	query = `
+		UPDATE users SET username = $1, username_changed_at = NOW() WHERE id = $2;
+	`
+
+	if _, err := tx.ExecContext(ctx, query, to, userID); err != nil {
+		return uniqueViolation(err)
+	}
+
+	// Changing only the case of a username needs no redirect.
+	if strings.EqualFold(from, to) {
+		return nil
+	}
+
+	query = `
+		INSERT INTO username_redirects (old_username, user_id) VALUES ($1, $2);
+	`
+
+	_, err := tx.ExecContext(ctx, query, from, userID)
+	return err
+}
+
+// RequestEmailChange records a new email address for the user, replacing
+// any earlier request. It only takes effect once ConfirmEmailChange is called
+// with the token sent to that address.
+func (s *UserStore) RequestEmailChange(ctx context.Context, userID int64, email, token string, exp time.Duration) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		taken, err := emailTaken(ctx, tx, email)
+		if err != nil {
+			return err
+		}
+
+		if taken {
+			return ErrDuplicateEmail
+		}
+
+		query := `
+			DELETE FROM email_changes WHERE user_id = $1;
+		`
+
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			return err
+		}
+
+		query = `
+			INSERT INTO email_changes (token, user_id, email, expiry) VALUES ($1, $2, $3, $4);
+		`
+
+		_, err = tx.ExecContext(ctx, query, hashToken(token), userID, email, time.Now().Add(exp))
+		return err
+	})
+}
+
+// IsEmailTaken reports whether an account, activated or not, uses the email
+// address.
+func (s *UserStore) IsEmailTaken(ctx context.Context, email string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return emailTaken(ctx, s.db, email)
+}
+
+func emailTaken(ctx context.Context, q querier, email string) (bool, error) {
+	var taken bool
+
+	query := `
+		SELECT EXISTS (SELECT 1 FROM users WHERE email = $1);
+	`
+
+	err := q.QueryRowContext(ctx, query, email).Scan(&taken)
+	return taken, err
+}
+
+// ConfirmEmailChange switches the user to the email address the token was
+// sent to.
+func (s *UserStore) ConfirmEmailChange(ctx context.Context, token string) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		var userID int64
+		var email string
+
+		query := `
+			SELECT user_id, email FROM email_changes WHERE token = $1 AND expiry > $2;
+		`
+
+		err := tx.QueryRowContext(ctx, query, hashToken(token), time.Now()).Scan(&userID, &email)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		query = `
+			UPDATE users SET email = $1 WHERE id = $2;
+		`
+
+		if _, err := tx.ExecContext(ctx, query, email, userID); err != nil {
+			return uniqueViolation(err)
+		}
+
+		query = `
+			DELETE FROM email_changes WHERE user_id = $1;
+		`
+
+		_, err = tx.ExecContext(ctx, query, userID)
+		return err
+	})
+}
+
+// uniqueViolation maps violations of the unique email and username
+// constraints to their errors.
+func uniqueViolation(err error) error {
+	if pqError, ok := err.(*pq.Error); ok && pqError.Code == "23505" {
+		switch pqError.Constraint {
+		case "users_email_key":
+			return ErrDuplicateEmail
+		case "users_username_key", "idx_users_username_lower":
+			return ErrDuplicateUsername
+		}
+	}
+
+	return err
+}
+
+func hashToken(token string) []byte {
+	hash := sha256.Sum256([]byte(token))
+	return hash[:]
+}
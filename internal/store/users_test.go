@@ -0,0 +1,49 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCreateRejectsUsernameDifferingInCase(t *testing.T) {
+	s, _ := newTestStorage(t)
+
+	createTestUser(t, s, "case_insensitive")
+
+	user := &User{
+		Username: "Case_Insensitive",
+		Email:    "case_insensitive_2@example.com",
+		Password: "password",
+	}
+
+	if err := s.Users.Create(context.Background(), user); !errors.Is(err, ErrDuplicateUsername) {
+		t.Fatalf("err = %v, want ErrDuplicateUsername", err)
+	}
+}
+
+func TestIsEmailTaken(t *testing.T) {
+	s, _ := newTestStorage(t)
+	ctx := context.Background()
+
+	user := createTestUser(t, s, "email_taken")
+
+	tests := []struct {
+		email string
+		want  bool
+	}{
+		{user.Email, true},
+		{"email_free@example.com", false},
+	}
+
+	for _, tt := range tests {
+		taken, err := s.Users.IsEmailTaken(ctx, tt.email)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if taken != tt.want {
+			t.Errorf("IsEmailTaken(%q) = %t, want %t", tt.email, taken, tt.want)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// Package stream delivers real-time events to connected clients.
+package stream
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+)
+
+// Event is pushed to every subscriber of its topic. Data is the JSON
+// representation of the post, comment, notification or message it is about.
+type Event struct {
+	Topic string          `json:"topic"`
+	Type  string          `json:"type"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// UserTopic carries the events addressed to a user: comments on their posts
+// and their notifications.
+func UserTopic(userID int64) string {
+	return "user:" + strconv.FormatInt(userID, 10)
+}
+
+// AuthorTopic carries the posts written by a user.
+func AuthorTopic(userID int64) string {
+	return "author:" + strconv.FormatInt(userID, 10)
+}
+
+// Hub is an in-process publish/subscribe hub fanning events out to the
+// subscribers of their topic.
+type Hub struct {
+	mu         sync.RWMutex
+	topics     map[string]map[*Subscription]struct{}
+	bufferSize int
+	closed     bool
+}
+
+// Subscription receives the events of the topics it was created for on C,
+// which is closed when the hub is.
+type Subscription struct {
+	C      <-chan Event
+	c      chan Event
+	topics []string
+}
+
+func NewHub(bufferSize int) *Hub {
+	return &Hub{
+		topics:     map[string]map[*Subscription]struct{}{},
+		bufferSize: bufferSize,
+	}
+}
+
+func (h *Hub) Subscribe(topics ...string) *Subscription {
+	c := make(chan Event, h.bufferSize)
+	sub := &Subscription{C: c, c: c, topics: topics}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		close(c)
+		return sub
+	}
+
+	for _, topic := range topics {
+		if h.topics[topic] == nil {
+			h.topics[topic] = map[*Subscription]struct{}{}
+		}
+
+		h.topics[topic][sub] = struct{}{}
+	}
+
+	return sub
+}
+
+// Unsubscribe stops delivering events to sub.
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, topic := range sub.topics {
+		delete(h.topics[topic], sub)
+
+		if len(h.topics[topic]) == 0 {
+			delete(h.topics, topic)
+		}
+	}
+}
+
+// Publish delivers e to the subscribers of its topic. It never blocks:
+// subscribers whose buffer is full miss the event.
+func (h *Hub) Publish(e Event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for sub := range h.topics[e.Topic] {
+		select {
+		case sub.c <- e:
+		default:
+		}
+	}
+}
+
+// Close closes the channel of every subscription, now and to come, so that
+// the streams end when the server shuts down.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return
+	}
+
+	h.closed = true
+
+	closed := map[*Subscription]struct{}{}
+
+	for _, subs := range h.topics {
+		for sub := range subs {
+			if _, ok := closed[sub]; !ok {
+				close(sub.c)
+				closed[sub] = struct{}{}
+			}
+		}
+	}
+
+	h.topics = map[string]map[*Subscription]struct{}{}
+}
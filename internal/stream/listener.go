@@ -0,0 +1,85 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Channel is the PostgreSQL notification channel the database triggers
+// publish events on.
+const Channel = "stream_events"
+
+// notice is the payload of a notification. It only identifies the row, as
+// payloads are limited to 8000 bytes.
+type notice struct {
+	Topic string `json:"topic"`
+	Type  string `json:"type"`
+	ID    int64  `json:"id"`
+}
+
+// Loader loads the row an event of the given type is about. It returns nil
+// when the row no longer exists, in which case the event is dropped.
+type Loader func(ctx context.Context, eventType string, id int64) (any, error)
+
+// Listen relays the events published on Channel to the hub until ctx is
+// cancelled, loading their rows with load. Since every API instance listens,
+// events reach clients no matter which instance they are connected to.
+// Events sent while the connection is being re-established are lost.
+func Listen(ctx context.Context, addr string, hub *Hub, load Loader) error {
+	listener := pq.NewListener(addr, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("stream listener error: %s", err)
+		}
+	})
+
+	defer listener.Close()
+
+	if err := listener.Listen(Channel); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-listener.Notify:
+			// A nil notification signals that the connection was
+			// re-established.
+			if n == nil {
+				continue
+			}
+
+			var notice notice
+			if err := json.Unmarshal([]byte(n.Extra), &notice); err != nil {
+				log.Printf("invalid stream event: %s", err)
+				continue
+			}
+
+			row, err := load(ctx, notice.Type, notice.ID)
+			if err != nil {
+				log.Printf("error loading stream event %s %d: %s", notice.Type, notice.ID, err)
+				continue
+			}
+
+			if row == nil {
+				continue
+			}
+
+			data, err := json.Marshal(row)
+			if err != nil {
+				log.Printf("error encoding stream event %s %d: %s", notice.Type, notice.ID, err)
+				continue
+			}
+
+			hub.Publish(Event{Topic: notice.Topic, Type: notice.Type, Data: data})
+		case <-time.After(time.Minute):
+			// Make sure the connection is still alive when no events
+			// are flowing.
+			go listener.Ping()
+		}
+	}
+}